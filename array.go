@@ -1,32 +1,33 @@
 package surge
 
 import (
+	"fmt"
 	"reflect"
 )
 
-func sizeHintReflectedArray(v reflect.Value) int {
+func (codec *Codec) sizeHintReflectedArray(v reflect.Value, depth int) int {
 	sizeHint := 0
 	for i := 0; i < v.Len(); i++ {
-		sizeHint += sizeHintReflected(v.Index(i))
+		sizeHint += codec.sizeHintReflected(v.Index(i), depth+1)
 	}
 	return sizeHint
 }
 
-func marshalReflectedArray(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
+func (codec *Codec) marshalReflectedArray(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
 	arrayLen := v.Len()
 	if len(buf) < arrayLen || rem < arrayLen {
 		return buf, rem, ErrUnexpectedEndOfBuffer
 	}
 	var err error
 	for i := 0; i < arrayLen; i++ {
-		if buf, rem, err = marshalReflected(v.Index(i), buf, rem); err != nil {
+		if buf, rem, err = codec.marshalReflected(v.Index(i), buf, rem, depth+1); err != nil {
 			return buf, rem, err
 		}
 	}
 	return buf, rem, nil
 }
 
-func unmarshalReflectedArray(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
+func (codec *Codec) unmarshalReflectedArray(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
 	elem := v.Elem()
 	arrayLen := elem.Len()
 	if len(buf) < arrayLen || rem < arrayLen {
@@ -34,8 +35,8 @@ func unmarshalReflectedArray(v reflect.Value, buf []byte, rem int) ([]byte, int,
 	}
 	var err error
 	for i := 0; i < arrayLen; i++ {
-		if buf, rem, err = unmarshalReflected(elem.Index(i).Addr(), buf, rem); err != nil {
-			return buf, rem, err
+		if buf, rem, err = codec.unmarshalReflected(elem.Index(i).Addr(), buf, rem, depth+1); err != nil {
+			return buf, rem, withPathPrefix(err, fmt.Sprintf("[%d]", i))
 		}
 	}
 	return buf, rem, nil
@@ -35,3 +35,14 @@ func UnmarshalBool(x *bool, buf []byte, rem int) ([]byte, int, error) {
 	*x = buf[0] != 0
 	return buf[SizeHintBool:], rem - SizeHintBool, nil
 }
+
+func (codec *Codec) marshalBool(x bool, buf []byte, rem int) ([]byte, int, error) {
+	return MarshalBool(x, buf, rem)
+}
+
+func (codec *Codec) unmarshalBool(x *bool, buf []byte, rem int) ([]byte, int, error) {
+	if codec.opts.Strict && len(buf) >= SizeHintBool && buf[0] > 1 {
+		return buf, rem, ErrNonCanonical
+	}
+	return UnmarshalBool(x, buf, rem)
+}
@@ -0,0 +1,173 @@
+package surge
+
+import (
+	"encoding/binary"
+	"reflect"
+)
+
+// Options configure the limits, and the binary representation, used when
+// marshaling and unmarshaling values. The zero value of an option selects its
+// default.
+type Options struct {
+	// MaxBytes is the memory quota used by ToBinary and FromBinary. It
+	// defaults to MaxBytes.
+	MaxBytes int
+	// MaxDepth is the maximum nesting depth of a value. It defaults to
+	// MaxDepth. A negative value prevents anything from being marshaled or
+	// unmarshaled.
+	MaxDepth int
+	// MaxLen is the maximum length of strings, byte slices, slices, and maps.
+	// It is checked immediately after the length prefix is read, before
+	// anything is allocated. It defaults to zero, which means that lengths are
+	// only restricted by the memory quota.
+	MaxLen int
+	// Strict rejects non-canonical encodings when unmarshaling. Booleans must
+	// be zero or one, map keys must be unique and in ascending order, and
+	// FromBinary must consume the entire byte slice. It defaults to false.
+	Strict bool
+	// ByteOrder is used for scalars and length prefixes. It defaults to
+	// big-endian. It only applies to values that are marshaled reflectively,
+	// and to custom implementations of MarshalerWithOptions and
+	// UnmarshalerWithOptions that use the MarshalU16, MarshalU32, MarshalU64,
+	// and MarshalLen methods (and their unmarshaling counterparts) of a Codec
+	// created from their options. The package-level helpers, such as
+	// MarshalU32 and MarshalBytes, are always big-endian, so custom
+	// implementations of Marshaler and Unmarshaler that use them will be
+	// big-endian, even when the rest of the value is not.
+	ByteOrder binary.ByteOrder
+	// ZeroCopy unmarshals byte slices by referencing the byte slice being
+	// unmarshaled from, instead of copying it. The byte slice must not be
+	// modified while the unmarshaled value is in use. Strings are always
+	// copied. It defaults to false.
+	ZeroCopy bool
+}
+
+// DefaultOptions returns the options used by ToBinary, FromBinary, SizeHint,
+// Marshal, and Unmarshal.
+func DefaultOptions() Options {
+	return Options{
+		MaxBytes:  MaxBytes,
+		MaxDepth:  MaxDepth,
+		ByteOrder: binary.BigEndian,
+	}
+}
+
+// A MarshalerWithOptions can marshal itself into bytes using the options of
+// the Codec that is marshaling it. It takes precedence over the Marshaler
+// interface.
+type MarshalerWithOptions interface {
+	SizeHinter
+
+	// MarshalWithOptions marshals this value into bytes. The maximum depth of
+	// the options is the remaining depth available to values nested inside
+	// this value.
+	MarshalWithOptions(buf []byte, rem int, opts Options) ([]byte, int, error)
+}
+
+// An UnmarshalerWithOptions can unmarshal itself from bytes using the options
+// of the Codec that is unmarshaling it. It takes precedence over the
+// Unmarshaler interface.
+type UnmarshalerWithOptions interface {
+	// UnmarshalWithOptions unmarshals this value from bytes. The maximum depth
+	// of the options is the remaining depth available to values nested inside
+	// this value.
+	UnmarshalWithOptions(buf []byte, rem int, opts Options) ([]byte, int, error)
+}
+
+// A Codec marshals and unmarshals values using its own Options. Different
+// codecs can be used to apply different limits to different sources of input.
+// A Codec is safe for concurrent use.
+//
+//  codec := surge.NewCodec(surge.Options{MaxBytes: 1024, MaxLen: 16})
+//  data, err := codec.ToBinary(x)
+//  if err != nil {
+//      panic(err)
+//  }
+//
+type Codec struct {
+	opts Options
+}
+
+// NewCodec returns a Codec that uses the given options. Options that are not
+// set are replaced by their defaults.
+func NewCodec(opts Options) *Codec {
+	defaults := DefaultOptions()
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaults.MaxBytes
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = defaults.MaxDepth
+	}
+	if opts.MaxLen < 0 {
+		opts.MaxLen = 0
+	}
+	if opts.ByteOrder == nil {
+		opts.ByteOrder = defaults.ByteOrder
+	}
+	return &Codec{opts: opts}
+}
+
+// Options returns the options used by the Codec.
+func (codec *Codec) Options() Options {
+	return codec.opts
+}
+
+// ToBinary returns the byte representation of a value. It uses the maximum
+// memory quota of the Codec to restrict the number of bytes that will be
+// allocated during marshaling.
+func (codec *Codec) ToBinary(v interface{}) ([]byte, error) {
+	buf := make([]byte, codec.SizeHint(v))
+	_, _, err := codec.Marshal(v, buf, codec.opts.MaxBytes)
+	return buf, err
+}
+
+// FromBinary unmarshals a byte representation of a value to a pointer to that
+// value. It uses the maximum memory quota of the Codec to restrict the number
+// of bytes that will be allocated during unmarshaling. In strict mode, an error
+// is returned if the byte slice is not entirely consumed.
+func (codec *Codec) FromBinary(v interface{}, buf []byte) error {
+	tail, _, err := codec.Unmarshal(v, buf, codec.opts.MaxBytes)
+	if err != nil {
+		return err
+	}
+	if codec.opts.Strict && len(tail) != 0 {
+		return ErrTrailingBytes
+	}
+	return nil
+}
+
+// SizeHint returns the number of bytes required to store a value in its binary
+// representation. See the package-level SizeHint for more information.
+func (codec *Codec) SizeHint(v interface{}) int {
+	return codec.sizeHintReflected(reflect.ValueOf(v), 0)
+}
+
+// Marshal a value into its binary representation, and store the value in a byte
+// slice. See the package-level Marshal for more information.
+func (codec *Codec) Marshal(v interface{}, buf []byte, rem int) ([]byte, int, error) {
+	return codec.marshalReflected(reflect.ValueOf(v), buf, rem, 0)
+}
+
+// Unmarshal a value from its binary representation by reading from a byte
+// slice. See the package-level Unmarshal for more information.
+func (codec *Codec) Unmarshal(v interface{}, buf []byte, rem int) ([]byte, int, error) {
+	valueOf := reflect.ValueOf(v)
+	if valueOf.Kind() != reflect.Ptr {
+		return buf, rem, NewErrUnsupportedUnmarshalType(v)
+	}
+	return codec.unmarshalReflected(valueOf, buf, rem, 0)
+}
+
+// optionsAt returns the options seen by custom implementations that are nested
+// at the given depth. The maximum depth is reduced so that values nested inside
+// the custom implementation cannot exceed the maximum depth of the Codec.
+func (codec *Codec) optionsAt(depth int) Options {
+	opts := codec.opts
+	opts.MaxDepth -= depth + 1
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = -1
+	}
+	return opts
+}
+
+var defaultCodec = NewCodec(DefaultOptions())
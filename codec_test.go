@@ -0,0 +1,251 @@
+package surge_test
+
+import (
+	"encoding/binary"
+	"testing/quick"
+
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type OptionsSpy struct {
+	Opts surge.Options
+}
+
+func (spy OptionsSpy) SizeHint() int {
+	return 0
+}
+
+func (spy OptionsSpy) MarshalWithOptions(buf []byte, rem int, opts surge.Options) ([]byte, int, error) {
+	return buf, rem, nil
+}
+
+func (spy *OptionsSpy) UnmarshalWithOptions(buf []byte, rem int, opts surge.Options) ([]byte, int, error) {
+	spy.Opts = opts
+	return buf, rem, nil
+}
+
+type OptionsSpyContainer struct {
+	Spy OptionsSpy
+}
+
+// Ordered is a custom implementation that follows the byte order of the codec
+// that is marshaling it.
+type Ordered struct {
+	Round uint16
+	Nonce uint64
+	Votes []uint32
+}
+
+func (o Ordered) SizeHint() int {
+	return surge.SizeHintU16 + surge.SizeHintU64 + surge.SizeHintU32 + surge.SizeHintU32*len(o.Votes)
+}
+
+func (o Ordered) MarshalWithOptions(buf []byte, rem int, opts surge.Options) ([]byte, int, error) {
+	codec := surge.NewCodec(opts)
+	buf, rem, err := codec.MarshalU16(o.Round, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	if buf, rem, err = codec.MarshalU64(o.Nonce, buf, rem); err != nil {
+		return buf, rem, err
+	}
+	if buf, rem, err = codec.MarshalLen(uint32(len(o.Votes)), buf, rem); err != nil {
+		return buf, rem, err
+	}
+	for _, vote := range o.Votes {
+		if buf, rem, err = codec.MarshalU32(vote, buf, rem); err != nil {
+			return buf, rem, err
+		}
+	}
+	return buf, rem, nil
+}
+
+func (o *Ordered) UnmarshalWithOptions(buf []byte, rem int, opts surge.Options) ([]byte, int, error) {
+	codec := surge.NewCodec(opts)
+	buf, rem, err := codec.UnmarshalU16(&o.Round, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	if buf, rem, err = codec.UnmarshalU64(&o.Nonce, buf, rem); err != nil {
+		return buf, rem, err
+	}
+	n := uint32(0)
+	if buf, rem, err = codec.UnmarshalLen(&n, surge.SizeHintU32, buf, rem); err != nil {
+		return buf, rem, err
+	}
+	o.Votes = make([]uint32, n)
+	for i := range o.Votes {
+		if buf, rem, err = codec.UnmarshalU32(&o.Votes[i], buf, rem); err != nil {
+			return buf, rem, err
+		}
+	}
+	return buf, rem, nil
+}
+
+var _ = Describe("Codec", func() {
+	Context("when creating a codec without options", func() {
+		It("should use the default options", func() {
+			Expect(surge.NewCodec(surge.Options{}).Options()).To(Equal(surge.DefaultOptions()))
+		})
+	})
+
+	Context("when marshaling and then unmarshaling with custom options", func() {
+		It("should return itself", func() {
+			codecs := []*surge.Codec{
+				surge.NewCodec(surge.Options{ByteOrder: binary.LittleEndian}),
+				surge.NewCodec(surge.Options{Strict: true}),
+				surge.NewCodec(surge.Options{ZeroCopy: true}),
+			}
+			for _, codec := range codecs {
+				f := func(x MyStruct, m map[string]int32) bool {
+					data, err := codec.ToBinary(x)
+					Expect(err).ToNot(HaveOccurred())
+					y := MyStruct{}
+					Expect(codec.FromBinary(&y, data)).To(Succeed())
+					Expect(y).To(Equal(x))
+
+					data, err = codec.ToBinary(m)
+					Expect(err).ToNot(HaveOccurred())
+					n := map[string]int32{}
+					Expect(codec.FromBinary(&n, data)).To(Succeed())
+					Expect(n).To(Equal(m))
+					return true
+				}
+				Expect(quick.Check(f, nil)).To(Succeed())
+			}
+		})
+	})
+
+	Context("when using a little-endian byte order", func() {
+		It("should marshal scalars and length prefixes in little-endian", func() {
+			codec := surge.NewCodec(surge.Options{ByteOrder: binary.LittleEndian})
+			data, err := codec.ToBinary([]uint16{0x0102})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte{1, 0, 0, 0, 2, 1}))
+		})
+
+		It("should marshal custom implementations that use the codec in little-endian", func() {
+			codec := surge.NewCodec(surge.Options{ByteOrder: binary.LittleEndian})
+			x := Ordered{Round: 0x0102, Nonce: 0x03, Votes: []uint32{0x04}}
+			data, err := codec.ToBinary(x)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte{2, 1, 3, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 4, 0, 0, 0}))
+
+			y := Ordered{}
+			Expect(codec.FromBinary(&y, data)).To(Succeed())
+			Expect(y).To(Equal(x))
+
+			data, err = surge.ToBinary(x)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte{1, 2, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 1, 0, 0, 0, 4}))
+		})
+	})
+
+	Context("when the memory quota is too small", func() {
+		It("should return an error", func() {
+			codec := surge.NewCodec(surge.Options{MaxBytes: 8})
+			data, err := surge.ToBinary("hello, world")
+			Expect(err).ToNot(HaveOccurred())
+			str := ""
+			Expect(codec.FromBinary(&str, data)).To(Equal(surge.ErrUnexpectedEndOfBuffer))
+		})
+	})
+
+	Context("when the max length is exceeded", func() {
+		codec := surge.NewCodec(surge.Options{MaxLen: 2})
+
+		It("should return an error when marshaling", func() {
+			_, err := codec.ToBinary([]uint64{1, 2, 3})
+			Expect(err).To(Equal(surge.ErrMaxLenExceeded))
+			_, err = codec.ToBinary("abc")
+			Expect(err).To(Equal(surge.ErrMaxLenExceeded))
+			_, err = codec.ToBinary(map[uint8]bool{1: true, 2: true, 3: true})
+			Expect(err).To(Equal(surge.ErrMaxLenExceeded))
+		})
+
+		It("should return an error when unmarshaling, before allocating", func() {
+			data := []byte{0xFF, 0xFF, 0xFF, 0xFF}
+			xs := []uint64{}
+			Expect(codec.FromBinary(&xs, data)).To(Equal(surge.ErrMaxLenExceeded))
+			bs := []byte{}
+			Expect(codec.FromBinary(&bs, data)).To(Equal(surge.ErrMaxLenExceeded))
+			m := map[uint8]bool{}
+			Expect(codec.FromBinary(&m, data)).To(Equal(surge.ErrMaxLenExceeded))
+		})
+	})
+
+	Context("when the max depth is exceeded", func() {
+		It("should return an error", func() {
+			codec := surge.NewCodec(surge.Options{MaxDepth: 4})
+			_, err := codec.ToBinary(nestedTree(2))
+			Expect(err).To(Equal(surge.ErrMaxDepthExceeded))
+			_, err = codec.ToBinary(nestedTree(1))
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when unmarshaling in strict mode", func() {
+		codec := surge.NewCodec(surge.Options{Strict: true})
+
+		It("should reject non-canonical booleans", func() {
+			x := false
+			Expect(surge.FromBinary(&x, []byte{2})).To(Succeed())
+			Expect(codec.FromBinary(&x, []byte{2})).To(Equal(surge.ErrNonCanonical))
+		})
+
+		It("should reject unsorted map keys", func() {
+			data := []byte{0, 0, 0, 2, 2, 1, 1, 1}
+			m := map[uint8]bool{}
+			Expect(surge.FromBinary(&m, data)).To(Succeed())
+			Expect(codec.FromBinary(&m, data)).To(Equal(surge.ErrNonCanonical))
+		})
+
+		It("should reject duplicate map keys", func() {
+			data := []byte{0, 0, 0, 2, 1, 1, 1, 0}
+			m := map[uint8]bool{}
+			Expect(surge.FromBinary(&m, data)).To(Succeed())
+			Expect(codec.FromBinary(&m, data)).To(Equal(surge.ErrNonCanonical))
+		})
+
+		It("should reject trailing bytes", func() {
+			x := uint8(0)
+			Expect(surge.FromBinary(&x, []byte{1, 2})).To(Succeed())
+			Expect(codec.FromBinary(&x, []byte{1, 2})).To(Equal(surge.ErrTrailingBytes))
+		})
+	})
+
+	Context("when unmarshaling with zero-copy", func() {
+		It("should reference the byte slice", func() {
+			codec := surge.NewCodec(surge.Options{ZeroCopy: true})
+			data := []byte{0, 0, 0, 2, 1, 2}
+			bs := []byte{}
+			Expect(codec.FromBinary(&bs, data)).To(Succeed())
+			Expect(bs).To(Equal([]byte{1, 2}))
+			data[4] = 3
+			Expect(bs).To(Equal([]byte{3, 2}))
+			Expect(cap(bs)).To(Equal(2))
+		})
+	})
+
+	Context("when a custom implementation uses options", func() {
+		It("should see the options of the codec", func() {
+			codec := surge.NewCodec(surge.Options{MaxLen: 42, MaxDepth: 10})
+			container := OptionsSpyContainer{}
+			Expect(codec.FromBinary(&container, []byte{})).To(Succeed())
+			Expect(container.Spy.Opts.MaxLen).To(Equal(42))
+			Expect(container.Spy.Opts.MaxDepth).To(Equal(8))
+			Expect(container.Spy.Opts.ByteOrder).To(Equal(binary.BigEndian))
+		})
+
+		It("should see the default options when using the package-level functions", func() {
+			spy := OptionsSpy{}
+			Expect(surge.FromBinary(&spy, []byte{})).To(Succeed())
+			expected := surge.DefaultOptions()
+			expected.MaxDepth--
+			Expect(spy.Opts).To(Equal(expected))
+		})
+	})
+})
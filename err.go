@@ -3,6 +3,7 @@ package surge
 import (
 	"errors"
 	"fmt"
+	"reflect"
 )
 
 // ErrUnexpectedEndOfBuffer is used when reading/writing from/to a buffer that
@@ -13,6 +14,26 @@ var ErrUnexpectedEndOfBuffer = errors.New("unexpected end of buffer")
 // overflowed.
 var ErrLengthOverflow = errors.New("max bytes exceeded")
 
+// ErrMaxDepthExceeded is returned when a value is nested deeper than the
+// maximum depth.
+var ErrMaxDepthExceeded = errors.New("max depth exceeded")
+
+// ErrMaxLenExceeded is returned when the length of a string, slice, or map
+// exceeds the maximum length.
+var ErrMaxLenExceeded = errors.New("max length exceeded")
+
+// ErrFixedLenMismatch is returned when the length of a string, or byte slice,
+// with a fixed length is not equal to that fixed length.
+var ErrFixedLenMismatch = errors.New("fixed length mismatch")
+
+// ErrNonCanonical is returned when unmarshaling in strict mode, and the binary
+// representation is not the one that would be produced by marshaling.
+var ErrNonCanonical = errors.New("non-canonical encoding")
+
+// ErrTrailingBytes is returned when unmarshaling in strict mode, and bytes
+// remain after the value has been unmarshaled.
+var ErrTrailingBytes = errors.New("trailing bytes")
+
 // ErrUnsupportedMarshalType is returned when the an unsupported type is
 // encountered during marshaling.
 type ErrUnsupportedMarshalType struct {
@@ -25,6 +46,13 @@ func NewErrUnsupportedMarshalType(v interface{}) error {
 	return ErrUnsupportedMarshalType{error: fmt.Errorf("marshal error: unsupported type %T", v)}
 }
 
+// newErrUnsupportedMarshalType constructs a new unsupported marshal type error
+// for the given reflected type. Unlike NewErrUnsupportedMarshalType, it can
+// report interface types, because it does not need a value of the type.
+func newErrUnsupportedMarshalType(t reflect.Type) error {
+	return ErrUnsupportedMarshalType{error: fmt.Errorf("marshal error: unsupported type %v", t)}
+}
+
 // ErrUnsupportedUnmarshalType is returned when the an unsupported type is
 // encountered during unmarshaling.
 type ErrUnsupportedUnmarshalType struct {
@@ -36,3 +64,98 @@ type ErrUnsupportedUnmarshalType struct {
 func NewErrUnsupportedUnmarshalType(v interface{}) error {
 	return ErrUnsupportedUnmarshalType{error: fmt.Errorf("unmarshal error: unsupported type %T", v)}
 }
+
+// newErrUnsupportedUnmarshalType constructs a new unsupported unmarshal type
+// error for the given reflected type.
+func newErrUnsupportedUnmarshalType(t reflect.Type) error {
+	return ErrUnsupportedUnmarshalType{error: fmt.Errorf("unmarshal error: unsupported type %v", t)}
+}
+
+// ErrInvalidTag is returned when a struct field has a surge struct tag that is
+// malformed, or that cannot be applied to the type of the field.
+type ErrInvalidTag struct {
+	error
+}
+
+// NewErrInvalidTag constructs a new invalid tag error for the given struct
+// field.
+func NewErrInvalidTag(field reflect.StructField, reason string) error {
+	return ErrInvalidTag{error: fmt.Errorf("invalid tag on field %v: %v", field.Name, reason)}
+}
+
+// ErrPathNotFound is returned when a path does not identify a value nested
+// inside the binary representation of a value.
+type ErrPathNotFound struct {
+	error
+}
+
+// NewErrPathNotFound constructs a new path not found error for the given
+// reason.
+func NewErrPathNotFound(reason string) error {
+	return ErrPathNotFound{error: fmt.Errorf("path not found: %v", reason)}
+}
+
+// ErrValidation is returned when an unmarshaled value implements the Validator
+// interface, and is invalid. The path identifies the invalid value relative to
+// the value being unmarshaled, using field names for struct fields, and
+// brackets for array, slice, and map elements (for example,
+// "Header.Signatures[2]"). Map elements are identified by their formatted key,
+// and invalid map keys are identified by their formatted key followed by
+// ".key" (for example, `Tally["alice"]` is an invalid value, and
+// `Tally["alice"].key` is an invalid key). String keys are quoted using Go
+// syntax, so that keys that are empty, or that contain brackets or dots, are
+// unambiguous. An empty path identifies the value being unmarshaled.
+type ErrValidation struct {
+	Path string
+	Err  error
+}
+
+// NewErrValidation constructs a new validation error for the given error
+// returned by Validate.
+func NewErrValidation(err error) error {
+	return ErrValidation{Err: err}
+}
+
+// Error implements the error interface.
+func (err ErrValidation) Error() string {
+	if err.Path == "" {
+		return fmt.Sprintf("validation error: %v", err.Err)
+	}
+	return fmt.Sprintf("validation error at %v: %v", err.Path, err.Err)
+}
+
+// Unwrap returns the error returned by Validate.
+func (err ErrValidation) Unwrap() error {
+	return err.Err
+}
+
+// withPathPrefix prepends an element to the path of a validation error, as the
+// error is returned from a nested value to the value that contains it. Other
+// errors are returned unchanged.
+func withPathPrefix(err error, elem string) error {
+	validationErr, ok := err.(ErrValidation)
+	if !ok {
+		return err
+	}
+	switch {
+	case validationErr.Path == "":
+		validationErr.Path = elem
+	case validationErr.Path[0] == '[':
+		validationErr.Path = elem + validationErr.Path
+	default:
+		validationErr.Path = elem + "." + validationErr.Path
+	}
+	return validationErr
+}
+
+// ErrTypeMismatch is returned when a value does not have the type that is
+// expected.
+type ErrTypeMismatch struct {
+	error
+}
+
+// NewErrTypeMismatch constructs a new type mismatch error for the given
+// expected type and value.
+func NewErrTypeMismatch(expected reflect.Type, v interface{}) error {
+	return ErrTypeMismatch{error: fmt.Errorf("type mismatch: expected %v, got %T", expected, v)}
+}
@@ -3,6 +3,8 @@ package surge
 import (
 	"encoding/binary"
 	"math"
+	"reflect"
+	"unsafe"
 )
 
 const (
@@ -65,3 +67,18 @@ func UnmarshalF64(x *float64, buf []byte, rem int) ([]byte, int, error) {
 	*x = math.Float64frombits(binary.BigEndian.Uint64(buf))
 	return buf[SizeHintF64:], rem - SizeHintF64, nil
 }
+
+// float32Bits returns the bits of a reflected float32 value. Converting a
+// float32 to a float64, and back again, quietens signalling NaNs, so NaNs are
+// read directly from memory instead.
+func float32Bits(v reflect.Value) uint32 {
+	if f := v.Float(); f == f {
+		return math.Float32bits(float32(f))
+	}
+	if !v.CanAddr() {
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		v = c
+	}
+	return *(*uint32)(unsafe.Pointer(v.UnsafeAddr()))
+}
@@ -5,6 +5,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/renproject/surge"
 	"github.com/renproject/surge/surgeutil"
 )
 
@@ -27,6 +28,22 @@ var _ = Describe("Float", func() {
 		})
 	})
 
+	Context("when marshaling and then unmarshaling a signalling NaN", func() {
+		It("should return the same bits", func() {
+			type Named float32
+			data := []byte{0xFF, 0x84, 0x30, 0x30}
+			x := struct {
+				F float32
+				N Named
+				A [1]float32
+			}{}
+			Expect(surge.FromBinary(&x, append(append(append([]byte{}, data...), data...), data...))).To(Succeed())
+			reencoded, err := surge.ToBinary(x)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reencoded).To(Equal(append(append(append([]byte{}, data...), data...), data...)))
+		})
+	})
+
 	Context("when fuzzing", func() {
 		It("should not panic", func() {
 			for trial := 0; trial < numTrials; trial++ {
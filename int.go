@@ -238,3 +238,96 @@ func UnmarshalI64(x *int64, buf []byte, rem int) ([]byte, int, error) {
 	*x = int64(binary.BigEndian.Uint64(buf))
 	return buf[SizeHintI64:], rem - SizeHintI64, nil
 }
+
+func (codec *Codec) marshalUint(x uint64, size int, buf []byte, rem int) ([]byte, int, error) {
+	if len(buf) < size || rem < size {
+		return buf, rem, ErrUnexpectedEndOfBuffer
+	}
+	switch size {
+	case SizeHintU8:
+		buf[0] = uint8(x)
+	case SizeHintU16:
+		codec.opts.ByteOrder.PutUint16(buf, uint16(x))
+	case SizeHintU32:
+		codec.opts.ByteOrder.PutUint32(buf, uint32(x))
+	default:
+		codec.opts.ByteOrder.PutUint64(buf, x)
+	}
+	return buf[size:], rem - size, nil
+}
+
+func (codec *Codec) unmarshalUint(size int, buf []byte, rem int) (uint64, []byte, int, error) {
+	if len(buf) < size || rem < size {
+		return 0, buf, rem, ErrUnexpectedEndOfBuffer
+	}
+	var x uint64
+	switch size {
+	case SizeHintU8:
+		x = uint64(buf[0])
+	case SizeHintU16:
+		x = uint64(codec.opts.ByteOrder.Uint16(buf))
+	case SizeHintU32:
+		x = uint64(codec.opts.ByteOrder.Uint32(buf))
+	default:
+		x = codec.opts.ByteOrder.Uint64(buf)
+	}
+	return x, buf[size:], rem - size, nil
+}
+
+// MarshalU16 is the same as the package-level MarshalU16, but uses the byte
+// order of the Codec. Custom implementations of MarshalerWithOptions can use
+// it to follow the byte order of the Codec that is marshaling them.
+//
+//  func (x MyUint16) MarshalWithOptions(buf []byte, rem int, opts surge.Options) ([]byte, int, error) {
+//      return surge.NewCodec(opts).MarshalU16(uint16(x), buf, rem)
+//  }
+//
+func (codec *Codec) MarshalU16(x uint16, buf []byte, rem int) ([]byte, int, error) {
+	return codec.marshalUint(uint64(x), SizeHintU16, buf, rem)
+}
+
+// MarshalU32 is the same as the package-level MarshalU32, but uses the byte
+// order of the Codec.
+func (codec *Codec) MarshalU32(x uint32, buf []byte, rem int) ([]byte, int, error) {
+	return codec.marshalUint(uint64(x), SizeHintU32, buf, rem)
+}
+
+// MarshalU64 is the same as the package-level MarshalU64, but uses the byte
+// order of the Codec.
+func (codec *Codec) MarshalU64(x uint64, buf []byte, rem int) ([]byte, int, error) {
+	return codec.marshalUint(x, SizeHintU64, buf, rem)
+}
+
+// UnmarshalU16 is the same as the package-level UnmarshalU16, but uses the
+// byte order of the Codec. Custom implementations of UnmarshalerWithOptions
+// can use it to follow the byte order of the Codec that is unmarshaling them.
+func (codec *Codec) UnmarshalU16(x *uint16, buf []byte, rem int) ([]byte, int, error) {
+	y, buf, rem, err := codec.unmarshalUint(SizeHintU16, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	*x = uint16(y)
+	return buf, rem, nil
+}
+
+// UnmarshalU32 is the same as the package-level UnmarshalU32, but uses the
+// byte order of the Codec.
+func (codec *Codec) UnmarshalU32(x *uint32, buf []byte, rem int) ([]byte, int, error) {
+	y, buf, rem, err := codec.unmarshalUint(SizeHintU32, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	*x = uint32(y)
+	return buf, rem, nil
+}
+
+// UnmarshalU64 is the same as the package-level UnmarshalU64, but uses the
+// byte order of the Codec.
+func (codec *Codec) UnmarshalU64(x *uint64, buf []byte, rem int) ([]byte, int, error) {
+	y, buf, rem, err := codec.unmarshalUint(SizeHintU64, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	*x = y
+	return buf, rem, nil
+}
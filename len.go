@@ -1,5 +1,9 @@
 package surge
 
+import (
+	"math"
+)
+
 // MarshalLen marshals the given slice length.
 func MarshalLen(l uint32, buf []byte, rem int) ([]byte, int, error) {
 	return MarshalU32(l, buf, rem)
@@ -13,7 +17,14 @@ func UnmarshalLen(dst *uint32, elemSize int, buf []byte, rem int) ([]byte, int,
 	if err != nil {
 		return buf, rem, err
 	}
+	if err := checkLen(l, elemSize, rem); err != nil {
+		return buf, rem, err
+	}
+	*dst = l
+	return buf, rem, nil
+}
 
+func checkLen(l uint32, elemSize int, rem int) error {
 	if elemSize < 1 {
 		elemSize = 1
 	}
@@ -24,13 +35,48 @@ func UnmarshalLen(dst *uint32, elemSize int, buf []byte, rem int) ([]byte, int,
 	// and in addition when elemSize >= 2^32 = 4 Gb. Elements with this size
 	// are unlikely to be used in practice.
 	if c/uint64(elemSize) != uint64(l) {
-		return buf, rem, ErrLengthOverflow
+		return ErrLengthOverflow
 	}
 
 	if uint64(rem) < c {
-		return buf, rem, ErrUnexpectedEndOfBuffer
+		return ErrUnexpectedEndOfBuffer
 	}
+	return nil
+}
 
-	*dst = l
+func (codec *Codec) marshalLen(l int, buf []byte, rem int) ([]byte, int, error) {
+	if codec.opts.MaxLen > 0 && l > codec.opts.MaxLen {
+		return buf, rem, ErrMaxLenExceeded
+	}
+	if uint64(l) > math.MaxUint32 {
+		return buf, rem, ErrLengthOverflow
+	}
+	return codec.marshalUint(uint64(l), SizeHintU32, buf, rem)
+}
+
+func (codec *Codec) unmarshalLen(dst *uint32, elemSize int, buf []byte, rem int) ([]byte, int, error) {
+	l, buf, rem, err := codec.unmarshalUint(SizeHintU32, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	if codec.opts.MaxLen > 0 && l > uint64(codec.opts.MaxLen) {
+		return buf, rem, ErrMaxLenExceeded
+	}
+	if err := checkLen(uint32(l), elemSize, rem); err != nil {
+		return buf, rem, err
+	}
+	*dst = uint32(l)
 	return buf, rem, nil
 }
+
+// MarshalLen is the same as the package-level MarshalLen, but uses the byte
+// order, and the maximum length, of the Codec.
+func (codec *Codec) MarshalLen(l uint32, buf []byte, rem int) ([]byte, int, error) {
+	return codec.marshalLen(int(l), buf, rem)
+}
+
+// UnmarshalLen is the same as the package-level UnmarshalLen, but uses the byte
+// order, and the maximum length, of the Codec.
+func (codec *Codec) UnmarshalLen(dst *uint32, elemSize int, buf []byte, rem int) ([]byte, int, error) {
+	return codec.unmarshalLen(dst, elemSize, buf, rem)
+}
@@ -1,23 +1,26 @@
 package surge
 
 import (
+	"bytes"
+	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
 	"unsafe"
 )
 
-func sizeHintReflectedMap(v reflect.Value) int {
+func (codec *Codec) sizeHintReflectedMap(v reflect.Value, depth int) int {
 	sizeHint := SizeHintU32
 	iter := v.MapRange()
 	for iter.Next() {
-		sizeHint += sizeHintReflected(iter.Key())
-		sizeHint += sizeHintReflected(iter.Value())
+		sizeHint += codec.sizeHintReflected(iter.Key(), depth+1)
+		sizeHint += codec.sizeHintReflected(iter.Value(), depth+1)
 	}
 	return sizeHint
 }
 
-func marshalReflectedMap(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
-	buf, rem, err := MarshalLen(uint32(v.Len()), buf, rem)
+func (codec *Codec) marshalReflectedMap(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	buf, rem, err := codec.marshalLen(v.Len(), buf, rem)
 	if err != nil {
 		return buf, rem, err
 	}
@@ -48,7 +51,7 @@ func marshalReflectedMap(v reflect.Value, buf []byte, rem int) ([]byte, int, err
 	for _, key := range v.MapKeys() {
 		// Marshal the key into bytes, so that we can guarantee that the keys
 		// can be compared.
-		sizeHint := sizeHintReflected(key)
+		sizeHint := codec.sizeHintReflected(key, depth+1)
 		if rem < sizeHint {
 			return buf, rem, ErrUnexpectedEndOfBuffer
 		}
@@ -57,29 +60,14 @@ func marshalReflectedMap(v reflect.Value, buf []byte, rem int) ([]byte, int, err
 			keyData: make([]byte, sizeHint),
 			key:     key,
 		}
-		if _, rem, err = marshalReflected(key, keyValue.keyData, rem+sizeHint); err != nil {
+		if _, rem, err = codec.marshalReflected(key, keyValue.keyData, rem+sizeHint, depth+1); err != nil {
 			return buf, rem, err
 		}
 
 		// Search and insert to ensure that the key/values are always in sorted
 		// order.
 		i := sort.Search(len(keyValues), func(i int) bool {
-			other := keyValues[i]
-			if len(keyValue.keyData) < len(other.keyData) {
-				return true
-			}
-			if len(keyValue.keyData) > len(other.keyData) {
-				return false
-			}
-			for j := range keyValue.keyData {
-				if keyValue.keyData[j] < other.keyData[j] {
-					return true
-				}
-				if keyValue.keyData[j] > other.keyData[j] {
-					return false
-				}
-			}
-			return true
+			return compareKeyData(keyValue.keyData, keyValues[i].keyData) <= 0
 		})
 		keyValues = append(keyValues, KeyValue{})
 		copy(keyValues[i+1:], keyValues[i:])
@@ -99,35 +87,77 @@ func marshalReflectedMap(v reflect.Value, buf []byte, rem int) ([]byte, int, err
 		buf = buf[keyDataLen:]
 
 		// Marshal the value.
-		if buf, rem, err = marshalReflected(v.MapIndex(keyValue.key), buf, rem); err != nil {
+		if buf, rem, err = codec.marshalReflected(v.MapIndex(keyValue.key), buf, rem, depth+1); err != nil {
 			return buf, rem, err
 		}
 	}
 	return buf, rem, nil
 }
 
-func unmarshalReflectedMap(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
+func (codec *Codec) unmarshalReflectedMap(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
 	var err error
 
 	mapLen := uint32(0)
 	elem := v.Elem()
 	size := int(elem.Type().Key().Size() + elem.Type().Elem().Size())
-	if buf, rem, err = UnmarshalLen(&mapLen, size, buf, rem); err != nil {
+	if buf, rem, err = codec.unmarshalLen(&mapLen, size, buf, rem); err != nil {
 		return buf, rem, err
 	}
 	rem -= int(mapLen) * size
-	elem.Set(reflect.MakeMapWithSize(elem.Type(), int(mapLen)))
+	// The map length has not been checked against the buffer yet, so the map
+	// is only preallocated for as many entries as there are bytes remaining.
+	// Otherwise, the overhead of the map would allow a malicious length to
+	// allocate several times more memory than is charged.
+	hint := int(mapLen)
+	if hint > len(buf) {
+		hint = len(buf)
+	}
+	elem.Set(reflect.MakeMapWithSize(elem.Type(), hint))
 
+	var prevKeyData []byte
 	for i := uint32(0); i < mapLen; i++ {
 		k := reflect.New(elem.Type().Key())
 		v := reflect.New(elem.Type().Elem())
-		if buf, rem, err = unmarshalReflected(k, buf, rem); err != nil {
-			return buf, rem, err
+		keyBuf := buf
+		if buf, rem, err = codec.unmarshalReflected(k, buf, rem, depth+1); err != nil {
+			return buf, rem, withPathPrefix(err, formatKey(reflect.Indirect(k))+".key")
 		}
-		if buf, rem, err = unmarshalReflected(v, buf, rem); err != nil {
-			return buf, rem, err
+		if codec.opts.Strict {
+			// In strict mode, keys must appear in the same order that they
+			// are marshaled, which also guarantees that they are unique.
+			keyData := keyBuf[:len(keyBuf)-len(buf)]
+			if i > 0 && compareKeyData(prevKeyData, keyData) >= 0 {
+				return buf, rem, ErrNonCanonical
+			}
+			prevKeyData = keyData
+		}
+		if buf, rem, err = codec.unmarshalReflected(v, buf, rem, depth+1); err != nil {
+			return buf, rem, withPathPrefix(err, formatKey(reflect.Indirect(k)))
 		}
 		elem.SetMapIndex(reflect.Indirect(k), reflect.Indirect(v))
 	}
 	return buf, rem, nil
 }
+
+// formatKey formats a map key as a bracketed path element. String keys are
+// quoted (using Go syntax), so that keys that are empty, or that contain
+// brackets or dots, are unambiguous, and can be used in the paths given to
+// Locate. Other keys are formatted using their default format.
+func formatKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return "[" + strconv.Quote(k.String()) + "]"
+	}
+	return fmt.Sprintf("[%v]", k.Interface())
+}
+
+// compareKeyData compares marshaled keys. Shorter keys are ordered before
+// longer keys, and keys of the same length are ordered lexicographically.
+func compareKeyData(keyData, other []byte) int {
+	if len(keyData) < len(other) {
+		return -1
+	}
+	if len(keyData) > len(other) {
+		return 1
+	}
+	return bytes.Compare(keyData, other)
+}
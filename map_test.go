@@ -1,12 +1,15 @@
 package surge_test
 
 import (
+	"encoding/binary"
 	"fmt"
 	"reflect"
 
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"github.com/renproject/surge/surgeutil"
 )
 
 var _ = Describe("Map", func() {
@@ -51,6 +54,14 @@ var _ = Describe("Map", func() {
 			})
 		})
 
+		Context(fmt.Sprintf("when marshaling %v maps repeatedly", t), func() {
+			It("should return the same bytes", func() {
+				for trial := 0; trial < numTrials; trial++ {
+					Expect(surgeutil.DeterminismCheck(t)).To(Succeed())
+				}
+			})
+		})
+
 		Context(fmt.Sprintf("when fuzzing %v maps", t), func() {
 			It("should not panic", func() {
 				for trial := 0; trial < numTrials; trial++ {
@@ -95,4 +106,21 @@ var _ = Describe("Map", func() {
 			})
 		})
 	}
+
+	Context("when unmarshaling a map with an inflated length", func() {
+		It("should not allocate much more than the memory quota", func() {
+			const quota = 1024 * 1024
+			data := make([]byte, 4+5000)
+			binary.BigEndian.PutUint32(data, quota/9)
+
+			var err error
+			allocated := surgeutil.AllocatedBytes(func() {
+				x := map[uint8]map[string]bool{}
+				_, _, err = surge.Unmarshal(&x, data, quota)
+			})
+
+			Expect(err).To(HaveOccurred())
+			Expect(allocated).To(BeNumerically("<", quota))
+		})
+	})
 })
@@ -0,0 +1,363 @@
+package surge
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A plan marshals and unmarshals values of one type. Everything that can be
+// known about the type is resolved once, when the plan is built: which custom
+// implementations it has, the plans of its elements and fields, its parsed
+// struct tags, and its size (if all of its values have the same size). Maps
+// are marshaled and unmarshaled by the Codec, because their keys are sorted by
+// their binary representation, which dominates the cost of using reflection.
+type plan struct {
+	kind reflect.Kind
+
+	sizeHinter             bool
+	marshaler              bool
+	marshalerWithOptions   bool
+	unmarshaler            bool
+	unmarshalerWithOptions bool
+	validator              bool
+
+	// size is the size hint of all values of the type, or zero if values of
+	// the type have different size hints. It is only used when the values
+	// nested inside the type are not deeper than the maximum depth, so depth
+	// is the number of levels of nesting that it covers.
+	size  int
+	depth int
+
+	bytes  bool
+	elem   *plan
+	fields []fieldPlan
+}
+
+// A fieldPlan is the plan of a struct field, and its parsed struct tag.
+type fieldPlan struct {
+	name string
+	tag  fieldTag
+	plan *plan
+}
+
+// newPlan builds the plan for a type. An error is returned if values of the
+// type, or of any type nested inside it, cannot be marshaled or unmarshaled.
+// Types that already have a plan are not planned again, so that recursive types
+// can be planned.
+func newPlan(t reflect.Type, plans map[reflect.Type]*plan) (*plan, error) {
+	if p, ok := plans[t]; ok {
+		return p, nil
+	}
+	ptr := reflect.PtrTo(t)
+	p := &plan{
+		kind:                   t.Kind(),
+		sizeHinter:             t.Implements(sizeHinter),
+		marshaler:              t.Implements(marshaler),
+		marshalerWithOptions:   t.Implements(marshalerWithOptions),
+		unmarshaler:            ptr.Implements(unmarshaler),
+		unmarshalerWithOptions: ptr.Implements(unmarshalerWithOptions),
+		validator:              ptr.Implements(validator),
+	}
+	plans[t] = p
+
+	// A custom implementation only replaces the default implementation of one
+	// direction, so the kind must still be supported in the other direction.
+	customMarshaler := p.marshaler || p.marshalerWithOptions
+	customUnmarshaler := p.unmarshaler || p.unmarshalerWithOptions
+	if customMarshaler && customUnmarshaler {
+		return p, nil
+	}
+
+	var err error
+
+	switch t.Kind() {
+	case reflect.Bool:
+		p.size, p.depth = SizeHintBool, 1
+	case reflect.Uint8, reflect.Int8:
+		p.size, p.depth = SizeHintU8, 1
+	case reflect.Uint16, reflect.Int16:
+		p.size, p.depth = SizeHintU16, 1
+	case reflect.Uint32, reflect.Int32, reflect.Float32:
+		p.size, p.depth = SizeHintU32, 1
+	case reflect.Uint64, reflect.Int64, reflect.Float64:
+		p.size, p.depth = SizeHintU64, 1
+	case reflect.String:
+
+	case reflect.Array:
+		if p.elem, err = newPlan(t.Elem(), plans); err != nil {
+			return nil, err
+		}
+		if p.elem.size > 0 && t.Len() > 0 {
+			p.size, p.depth = p.elem.size*t.Len(), 1+p.elem.depth
+		}
+
+	case reflect.Slice:
+		if p.elem, err = newPlan(t.Elem(), plans); err != nil {
+			return nil, err
+		}
+		p.bytes = t == reflect.TypeOf([]byte{})
+
+	case reflect.Map:
+		// The plans of the keys and values are not used, but they are still
+		// built to check that the keys and values are supported.
+		if _, err = newPlan(t.Key(), plans); err != nil {
+			return nil, err
+		}
+		if _, err = newPlan(t.Elem(), plans); err != nil {
+			return nil, err
+		}
+
+	case reflect.Struct:
+		tags, err := structTags(t)
+		if err != nil {
+			return nil, err
+		}
+		p.fields = make([]fieldPlan, t.NumField())
+		size, depth, fixed := 0, 0, true
+		for i := range p.fields {
+			p.fields[i].name = t.Field(i).Name
+			if tags != nil {
+				p.fields[i].tag = tags[i]
+			}
+			if p.fields[i].plan, err = newPlan(t.Field(i).Type, plans); err != nil {
+				return nil, err
+			}
+			switch {
+			case p.fields[i].tag.fixed > 0:
+				size += p.fields[i].tag.fixed
+			case p.fields[i].tag.isZero() && p.fields[i].plan.size > 0:
+				size += p.fields[i].plan.size
+				if p.fields[i].plan.depth > depth {
+					depth = p.fields[i].plan.depth
+				}
+			default:
+				fixed = false
+			}
+		}
+		if fixed && size > 0 {
+			p.size, p.depth = size, 1+depth
+		}
+
+	case reflect.Ptr:
+		// Pointers can be marshaled, but not unmarshaled.
+		if !customUnmarshaler {
+			return nil, NewErrUnsupportedUnmarshalType(reflect.New(t).Interface())
+		}
+		if p.elem, err = newPlan(t.Elem(), plans); err != nil {
+			return nil, err
+		}
+
+	default:
+		if customMarshaler {
+			return nil, newErrUnsupportedUnmarshalType(ptr)
+		}
+		return nil, newErrUnsupportedMarshalType(t)
+	}
+
+	if p.sizeHinter || customMarshaler {
+		p.size, p.depth = 0, 0
+	}
+	return p, nil
+}
+
+func (p *plan) sizeHint(codec *Codec, v reflect.Value, depth int) int {
+	if depth >= codec.opts.MaxDepth {
+		return 0
+	}
+	if p.size > 0 && depth+p.depth <= codec.opts.MaxDepth {
+		return p.size
+	}
+	if p.sizeHinter {
+		return v.Interface().(SizeHinter).SizeHint()
+	}
+
+	switch p.kind {
+	case reflect.Array:
+		sizeHint := 0
+		for i := 0; i < v.Len(); i++ {
+			sizeHint += p.elem.sizeHint(codec, v.Index(i), depth+1)
+		}
+		return sizeHint
+	case reflect.Slice:
+		if p.bytes {
+			return SizeHintU32 + v.Len()
+		}
+		sizeHint := SizeHintU32
+		for i := 0; i < v.Len(); i++ {
+			sizeHint += p.elem.sizeHint(codec, v.Index(i), depth+1)
+		}
+		return sizeHint
+	case reflect.Struct:
+		sizeHint := 0
+		for i, f := range p.fields {
+			if f.tag.fixed > 0 {
+				sizeHint += f.tag.fixed
+				continue
+			}
+			sizeHint += f.plan.sizeHint(codec, v.Field(i), depth+1)
+		}
+		return sizeHint
+	case reflect.Ptr:
+		if v.IsNil() {
+			return 0
+		}
+		return p.elem.sizeHint(codec, v.Elem(), depth+1)
+	}
+	return codec.sizeHintKind(v, depth)
+}
+
+func (p *plan) marshal(codec *Codec, v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if depth >= codec.opts.MaxDepth {
+		return buf, rem, ErrMaxDepthExceeded
+	}
+	if p.marshalerWithOptions {
+		return v.Interface().(MarshalerWithOptions).MarshalWithOptions(buf, rem, codec.optionsAt(depth))
+	}
+	if p.marshaler {
+		return v.Interface().(Marshaler).Marshal(buf, rem)
+	}
+
+	var err error
+
+	switch p.kind {
+	case reflect.Array:
+		arrayLen := v.Len()
+		if len(buf) < arrayLen || rem < arrayLen {
+			return buf, rem, ErrUnexpectedEndOfBuffer
+		}
+		for i := 0; i < arrayLen; i++ {
+			if buf, rem, err = p.elem.marshal(codec, v.Index(i), buf, rem, depth+1); err != nil {
+				return buf, rem, err
+			}
+		}
+		return buf, rem, nil
+	case reflect.Slice:
+		if p.bytes {
+			return codec.marshalBytes(v.Bytes(), buf, rem)
+		}
+		if buf, rem, err = codec.marshalLen(v.Len(), buf, rem); err != nil {
+			return buf, rem, err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if buf, rem, err = p.elem.marshal(codec, v.Index(i), buf, rem, depth+1); err != nil {
+				return buf, rem, err
+			}
+		}
+		return buf, rem, nil
+	case reflect.Struct:
+		for i, f := range p.fields {
+			if buf, rem, err = f.marshal(codec, v.Field(i), buf, rem, depth+1); err != nil {
+				return buf, rem, err
+			}
+		}
+		return buf, rem, nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return buf, rem, nil
+		}
+		return p.elem.marshal(codec, v.Elem(), buf, rem, depth+1)
+	}
+	return codec.marshalKind(v, buf, rem, depth)
+}
+
+func (p *plan) unmarshal(codec *Codec, v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if depth >= codec.opts.MaxDepth {
+		return buf, rem, ErrMaxDepthExceeded
+	}
+	buf, rem, err := p.unmarshalValue(codec, v, buf, rem, depth)
+	if err != nil {
+		return buf, rem, err
+	}
+	return buf, rem, p.validate(v)
+}
+
+// validate a value that has been unmarshaled, if it implements the Validator
+// interface.
+func (p *plan) validate(v reflect.Value) error {
+	if p.validator {
+		if err := v.Interface().(Validator).Validate(); err != nil {
+			return NewErrValidation(err)
+		}
+	}
+	return nil
+}
+
+func (p *plan) unmarshalValue(codec *Codec, v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if p.unmarshalerWithOptions {
+		return v.Interface().(UnmarshalerWithOptions).UnmarshalWithOptions(buf, rem, codec.optionsAt(depth))
+	}
+	if p.unmarshaler {
+		return v.Interface().(Unmarshaler).Unmarshal(buf, rem)
+	}
+
+	var err error
+	elem := v.Elem()
+
+	switch p.kind {
+	case reflect.Array:
+		arrayLen := elem.Len()
+		if len(buf) < arrayLen || rem < arrayLen {
+			return buf, rem, ErrUnexpectedEndOfBuffer
+		}
+		for i := 0; i < arrayLen; i++ {
+			if buf, rem, err = p.elem.unmarshal(codec, elem.Index(i).Addr(), buf, rem, depth+1); err != nil {
+				return buf, rem, withPathPrefix(err, fmt.Sprintf("[%d]", i))
+			}
+		}
+		return buf, rem, nil
+	case reflect.Slice:
+		if p.bytes {
+			return codec.unmarshalBytes(v.Interface().(*[]byte), buf, rem)
+		}
+		sliceLen := uint32(0)
+		size := int(elem.Type().Elem().Size())
+		if buf, rem, err = codec.unmarshalLen(&sliceLen, size, buf, rem); err != nil {
+			return buf, rem, err
+		}
+		rem -= int(sliceLen) * size
+
+		elem.Set(reflect.MakeSlice(elem.Type(), int(sliceLen), int(sliceLen)))
+		for i := uint32(0); i < sliceLen; i++ {
+			if buf, rem, err = p.elem.unmarshal(codec, elem.Index(int(i)).Addr(), buf, rem, depth+1); err != nil {
+				return buf, rem, withPathPrefix(err, fmt.Sprintf("[%d]", i))
+			}
+		}
+		return buf, rem, nil
+	case reflect.Struct:
+		for i, f := range p.fields {
+			if buf, rem, err = f.unmarshal(codec, elem.Field(i).Addr(), buf, rem, depth+1); err != nil {
+				return buf, rem, withPathPrefix(err, f.name)
+			}
+		}
+		return buf, rem, nil
+	}
+	return codec.unmarshalKind(v, buf, rem, depth)
+}
+
+// marshal a field, taking its struct tag into account.
+func (f fieldPlan) marshal(codec *Codec, v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if f.tag.fixed > 0 {
+		return codec.marshalFixed(v, f.tag.fixed, buf, rem)
+	}
+	if f.tag.maxLen > 0 && v.Len() > f.tag.maxLen {
+		return buf, rem, ErrMaxLenExceeded
+	}
+	return f.plan.marshal(codec, v, buf, rem, depth)
+}
+
+// unmarshal a field, taking its struct tag into account.
+func (f fieldPlan) unmarshal(codec *Codec, v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if f.tag.fixed > 0 {
+		buf, rem, err := codec.unmarshalFixed(v, f.tag.fixed, buf, rem)
+		if err != nil {
+			return buf, rem, err
+		}
+		return buf, rem, f.plan.validate(v)
+	}
+	// Peek at the length prefix so that the maximum length is checked before
+	// anything is allocated.
+	if f.tag.maxLen > 0 && len(buf) >= SizeHintU32 && uint64(codec.opts.ByteOrder.Uint32(buf)) > uint64(f.tag.maxLen) {
+		return buf, rem, ErrMaxLenExceeded
+	}
+	return f.plan.unmarshal(codec, v, buf, rem, depth)
+}
@@ -0,0 +1,70 @@
+package surge
+
+import (
+	"reflect"
+)
+
+// SizeHintReflected returns the number of bytes required to store a value in
+// its binary representation, ignoring any custom implementation of the value
+// itself. Values nested inside the value still use their custom
+// implementations. This is the size hint that the value would have if its type
+// did not implement the SizeHinter interface.
+func SizeHintReflected(v interface{}) int {
+	return defaultCodec.SizeHintReflected(v)
+}
+
+// MarshalReflected marshals a value into its binary representation, ignoring
+// any custom implementation of the value itself. Values nested inside the value
+// still use their custom implementations. This is the binary representation
+// that the value would have if its type did not implement the Marshaler
+// interface, and it is useful for checking that a custom implementation is
+// equivalent to the default one.
+//
+//  custom, _, err := surge.Marshal(x, buf1, surge.MaxBytes)
+//  reflected, _, err := surge.MarshalReflected(x, buf2, surge.MaxBytes)
+//
+func MarshalReflected(v interface{}, buf []byte, rem int) ([]byte, int, error) {
+	return defaultCodec.MarshalReflected(v, buf, rem)
+}
+
+// UnmarshalReflected unmarshals a value from its binary representation,
+// ignoring any custom implementation of the value itself. Values nested inside
+// the value still use their custom implementations, and the value is still
+// validated if it implements the Validator interface. If the value is not a
+// pointer, then an error is returned.
+func UnmarshalReflected(v interface{}, buf []byte, rem int) ([]byte, int, error) {
+	return defaultCodec.UnmarshalReflected(v, buf, rem)
+}
+
+// SizeHintReflected returns the number of bytes required to store a value in
+// its binary representation, ignoring any custom implementation of the value
+// itself. See the package-level SizeHintReflected for more information.
+func (codec *Codec) SizeHintReflected(v interface{}) int {
+	return codec.sizeHintKind(reflect.ValueOf(v), 0)
+}
+
+// MarshalReflected marshals a value into its binary representation, ignoring
+// any custom implementation of the value itself. See the package-level
+// MarshalReflected for more information.
+func (codec *Codec) MarshalReflected(v interface{}, buf []byte, rem int) ([]byte, int, error) {
+	valueOf := reflect.ValueOf(v)
+	if !valueOf.IsValid() {
+		return buf, rem, NewErrUnsupportedMarshalType(v)
+	}
+	return codec.marshalKind(valueOf, buf, rem, 0)
+}
+
+// UnmarshalReflected unmarshals a value from its binary representation,
+// ignoring any custom implementation of the value itself. See the
+// package-level UnmarshalReflected for more information.
+func (codec *Codec) UnmarshalReflected(v interface{}, buf []byte, rem int) ([]byte, int, error) {
+	valueOf := reflect.ValueOf(v)
+	if valueOf.Kind() != reflect.Ptr {
+		return buf, rem, NewErrUnsupportedUnmarshalType(v)
+	}
+	buf, rem, err := codec.unmarshalKind(valueOf, buf, rem, 0)
+	if err != nil {
+		return buf, rem, err
+	}
+	return buf, rem, validate(valueOf)
+}
@@ -0,0 +1,93 @@
+package surge_test
+
+import (
+	"errors"
+
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Version is a custom implementation that marshals its minor version before
+// its major version, unlike the reflective implementation.
+type Version struct {
+	Major uint16
+	Minor uint16
+}
+
+func (v Version) SizeHint() int {
+	return 2 * surge.SizeHintU16
+}
+
+func (v Version) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.MarshalU16(v.Minor, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	return surge.MarshalU16(v.Major, buf, rem)
+}
+
+func (v *Version) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.UnmarshalU16(&v.Minor, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	return surge.UnmarshalU16(&v.Major, buf, rem)
+}
+
+type Release struct {
+	Version Version
+	Name    string
+}
+
+var _ = Describe("Reflected", func() {
+	version := Version{Major: 1, Minor: 2}
+
+	Context("when marshaling a custom implementation reflectively", func() {
+		It("should ignore the custom implementation", func() {
+			buf := make([]byte, surge.SizeHintReflected(version))
+			tail, rem, err := surge.MarshalReflected(version, buf, 4)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tail).To(BeEmpty())
+			Expect(rem).To(Equal(0))
+			Expect(buf).To(Equal([]byte{0, 1, 0, 2}))
+
+			data, err := surge.ToBinary(version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte{0, 2, 0, 1}))
+		})
+
+		It("should not ignore nested custom implementations", func() {
+			release := Release{Version: version, Name: "a"}
+			buf := make([]byte, surge.SizeHintReflected(release))
+			_, _, err := surge.MarshalReflected(release, buf, surge.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf).To(Equal([]byte{0, 2, 0, 1, 0, 0, 0, 1, 'a'}))
+		})
+	})
+
+	Context("when unmarshaling a custom implementation reflectively", func() {
+		It("should ignore the custom implementation", func() {
+			x := Version{}
+			tail, rem, err := surge.UnmarshalReflected(&x, []byte{0, 1, 0, 2}, 4)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tail).To(BeEmpty())
+			Expect(rem).To(Equal(0))
+			Expect(x).To(Equal(version))
+		})
+
+		It("should return an error for non-pointers", func() {
+			_, _, err := surge.UnmarshalReflected(Version{}, []byte{0, 1, 0, 2}, 4)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should still validate", func() {
+			data, err := surge.ToBinary(Vote{Round: 1})
+			Expect(err).ToNot(HaveOccurred())
+			vote := Vote{}
+			_, _, err = surge.UnmarshalReflected(&vote, data, surge.MaxBytes)
+			Expect(errors.As(err, &surge.ErrValidation{})).To(BeTrue())
+		})
+	})
+})
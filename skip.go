@@ -0,0 +1,506 @@
+package surge
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Skip advances past one binary representation of a value of the given type,
+// and returns the unconsumed tail of the byte slice. Nothing is allocated,
+// unless the type (or a type nested inside it) has a custom implementation of
+// the Unmarshaler interface, in which case that value is unmarshaled in order
+// to find where it ends. Skip checks the byte slice in the same way as
+// Unmarshal, using the maximum memory quota, so that it succeeds if, and only
+// if, unmarshaling would succeed (ignoring validation).
+//
+//  header := Header{}
+//  body, err := surge.Skip(reflect.TypeOf(header), data)
+//  if err != nil {
+//      panic(err)
+//  }
+//
+func Skip(t reflect.Type, buf []byte) ([]byte, error) {
+	return defaultCodec.Skip(t, buf)
+}
+
+// Locate the binary representation of a value nested inside the binary
+// representation of a value of the given type. The path uses field names for
+// struct fields, and brackets for array, slice, and map elements (for example,
+// "Header.Signatures[2]"), and map elements are identified by the formatted
+// value of their key. String keys can be quoted using Go syntax (for example,
+// `Tags["a.b"]`), and must be quoted when they are empty, or contain brackets
+// or dots. The start (inclusive) and end (exclusive) of the nested
+// value in the byte slice are returned. Values that come before the nested
+// value are skipped in the same way as Skip, so they are not allocated (unless
+// they have a custom implementation of the Unmarshaler interface). The keys of
+// maps on the path are the exception: every key that comes before the nested
+// value is unmarshaled, and allocated, so that it can be compared with the
+// path.
+//
+//  start, end, err := surge.Locate(reflect.TypeOf(Block{}), data, "Header.Height")
+//  if err != nil {
+//      panic(err)
+//  }
+//  height := uint64(0)
+//  if err := surge.FromBinary(&height, data[start:end]); err != nil {
+//      panic(err)
+//  }
+//
+func Locate(t reflect.Type, buf []byte, path string) (int, int, error) {
+	return defaultCodec.Locate(t, buf, path)
+}
+
+// Skip advances past one binary representation of a value of the given type.
+// See the package-level Skip for more information.
+func (codec *Codec) Skip(t reflect.Type, buf []byte) ([]byte, error) {
+	tail, _, err := codec.skipReflected(t, buf, codec.opts.MaxBytes, 0)
+	return tail, err
+}
+
+// Locate the binary representation of a value nested inside the binary
+// representation of a value of the given type. See the package-level Locate for
+// more information.
+func (codec *Codec) Locate(t reflect.Type, buf []byte, path string) (int, int, error) {
+	loc, err := codec.locate(t, buf, path)
+	return loc.start, loc.end, err
+}
+
+// location of a nested value inside a byte slice.
+type location struct {
+	start int
+	end   int
+	t     reflect.Type
+	tag   fieldTag
+	depth int
+}
+
+func (codec *Codec) locate(t reflect.Type, buf []byte, path string) (location, error) {
+	loc, tail, rem, err := codec.seek(t, buf, path)
+	if err != nil {
+		return location{}, err
+	}
+	if tail, _, err = codec.skipTagged(loc.t, loc.tag, tail, rem, loc.depth); err != nil {
+		return location{}, err
+	}
+	loc.end = len(buf) - len(tail)
+	return loc, nil
+}
+
+// seek skips to the nested value identified by the path, and returns its
+// location (without an end), the tail of the byte slice at the start of the
+// nested value, and the remaining memory quota.
+func (codec *Codec) seek(t reflect.Type, buf []byte, path string) (location, []byte, int, error) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return location{}, buf, 0, err
+	}
+	loc := location{t: t}
+	tail, rem, err := codec.seekReflected(&loc, elems, buf, codec.opts.MaxBytes, 0)
+	if err != nil {
+		return location{}, buf, 0, err
+	}
+	loc.start = len(buf) - len(tail)
+	return loc, tail, rem, nil
+}
+
+// seekReflected skips to the nested value identified by the path elements. It
+// records the type, struct tag, and depth of the nested value in the location,
+// and returns the tail at the start of the nested value.
+func (codec *Codec) seekReflected(loc *location, elems []string, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if len(elems) == 0 {
+		loc.depth = depth
+		return buf, rem, nil
+	}
+	if depth >= codec.opts.MaxDepth {
+		return buf, rem, ErrMaxDepthExceeded
+	}
+	if !loc.tag.isZero() || HasCustomImplementation(loc.t) {
+		return buf, rem, NewErrPathNotFound(fmt.Sprintf("cannot look inside %v", loc.t))
+	}
+
+	var err error
+	elem := elems[0]
+	t := loc.t
+
+	switch t.Kind() {
+	case reflect.Struct:
+		tags, err := structTags(t)
+		if err != nil {
+			return buf, rem, err
+		}
+		for i := 0; i < t.NumField(); i++ {
+			tag := fieldTag{}
+			if tags != nil {
+				tag = tags[i]
+			}
+			if t.Field(i).Name == elem {
+				loc.t, loc.tag = t.Field(i).Type, tag
+				return codec.seekReflected(loc, elems[1:], buf, rem, depth+1)
+			}
+			if buf, rem, err = codec.skipTagged(t.Field(i).Type, tag, buf, rem, depth+1); err != nil {
+				return buf, rem, err
+			}
+		}
+		return buf, rem, NewErrPathNotFound(fmt.Sprintf("%v has no field %v", t, elem))
+
+	case reflect.Array, reflect.Slice:
+		i, err := parseIndex(elem)
+		if err != nil {
+			return buf, rem, err
+		}
+		n := 0
+		if t.Kind() == reflect.Array {
+			n = t.Len()
+			if len(buf) < n || rem < n {
+				return buf, rem, ErrUnexpectedEndOfBuffer
+			}
+		} else {
+			var sliceLen uint32
+			if buf, rem, err = codec.skipLen(t, &sliceLen, buf, rem); err != nil {
+				return buf, rem, err
+			}
+			n = int(sliceLen)
+		}
+		if i >= n {
+			return buf, rem, NewErrPathNotFound(fmt.Sprintf("index %v out of range", i))
+		}
+		if buf, rem, err = codec.skipElems(t.Elem(), i, buf, rem, depth+1); err != nil {
+			return buf, rem, err
+		}
+		loc.t, loc.tag = t.Elem(), fieldTag{}
+		return codec.seekReflected(loc, elems[1:], buf, rem, depth+1)
+
+	case reflect.Map:
+		if len(elem) < 2 || elem[0] != '[' {
+			return buf, rem, NewErrPathNotFound(fmt.Sprintf("expected map key, got %v", elem))
+		}
+		var mapLen uint32
+		if buf, rem, err = codec.skipLen(t, &mapLen, buf, rem); err != nil {
+			return buf, rem, err
+		}
+		for j := uint32(0); j < mapLen; j++ {
+			k := reflect.New(t.Key())
+			if buf, rem, err = codec.unmarshalReflectedValue(k, buf, rem, depth+1); err != nil {
+				return buf, rem, err
+			}
+			// Unquoted string keys are also accepted, for keys that are not
+			// ambiguous.
+			if formatKey(k.Elem()) == elem || fmt.Sprintf("[%v]", k.Elem().Interface()) == elem {
+				loc.t, loc.tag = t.Elem(), fieldTag{}
+				return codec.seekReflected(loc, elems[1:], buf, rem, depth+1)
+			}
+			if buf, rem, err = codec.skipReflected(t.Elem(), buf, rem, depth+1); err != nil {
+				return buf, rem, err
+			}
+		}
+		return buf, rem, NewErrPathNotFound(fmt.Sprintf("no key %v", elem[1:len(elem)-1]))
+	}
+
+	return buf, rem, NewErrPathNotFound(fmt.Sprintf("cannot look inside %v", t))
+}
+
+// skipReflected mirrors unmarshalReflected, checking the byte slice and
+// consuming the remaining memory quota in the same way, but without
+// allocating.
+func (codec *Codec) skipReflected(t reflect.Type, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if depth >= codec.opts.MaxDepth {
+		return buf, rem, ErrMaxDepthExceeded
+	}
+	if hasCustomUnmarshaler(t) {
+		return codec.unmarshalReflectedValue(reflect.New(t), buf, rem, depth)
+	}
+	if n, ok := codec.fixedSize(t); ok {
+		// Skipping in bulk does not visit the nested values, so their
+		// depth is charged up front.
+		if depth+fixedDepth(t) > codec.opts.MaxDepth {
+			return buf, rem, ErrMaxDepthExceeded
+		}
+		if len(buf) < n || rem < n {
+			return buf, rem, ErrUnexpectedEndOfBuffer
+		}
+		return buf[n:], rem - n, nil
+	}
+
+	var err error
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if codec.opts.Strict && len(buf) >= SizeHintBool && buf[0] > 1 {
+			return buf, rem, ErrNonCanonical
+		}
+		if len(buf) < SizeHintBool || rem < SizeHintBool {
+			return buf, rem, ErrUnexpectedEndOfBuffer
+		}
+		return buf[SizeHintBool:], rem - SizeHintBool, nil
+
+	case reflect.String:
+		var strLen uint32
+		if buf, rem, err = codec.unmarshalLen(&strLen, 1, buf, rem); err != nil {
+			return buf, rem, err
+		}
+		n := int(strLen)
+		if len(buf) < n {
+			return buf, rem, ErrUnexpectedEndOfBuffer
+		}
+		return buf[n:], rem - n, nil
+
+	case reflect.Array:
+		if len(buf) < t.Len() || rem < t.Len() {
+			return buf, rem, ErrUnexpectedEndOfBuffer
+		}
+		return codec.skipElems(t.Elem(), t.Len(), buf, rem, depth+1)
+
+	case reflect.Slice:
+		var sliceLen uint32
+		if buf, rem, err = codec.skipLen(t, &sliceLen, buf, rem); err != nil {
+			return buf, rem, err
+		}
+		if t == bytesType {
+			if len(buf) < int(sliceLen) {
+				return buf, rem, ErrUnexpectedEndOfBuffer
+			}
+			return buf[sliceLen:], rem, nil
+		}
+		return codec.skipElems(t.Elem(), int(sliceLen), buf, rem, depth+1)
+
+	case reflect.Map:
+		var mapLen uint32
+		if buf, rem, err = codec.skipLen(t, &mapLen, buf, rem); err != nil {
+			return buf, rem, err
+		}
+		var prevKeyData []byte
+		for i := uint32(0); i < mapLen; i++ {
+			keyBuf := buf
+			if buf, rem, err = codec.skipReflected(t.Key(), buf, rem, depth+1); err != nil {
+				return buf, rem, err
+			}
+			if codec.opts.Strict {
+				keyData := keyBuf[:len(keyBuf)-len(buf)]
+				if i > 0 && compareKeyData(prevKeyData, keyData) >= 0 {
+					return buf, rem, ErrNonCanonical
+				}
+				prevKeyData = keyData
+			}
+			if buf, rem, err = codec.skipReflected(t.Elem(), buf, rem, depth+1); err != nil {
+				return buf, rem, err
+			}
+		}
+		return buf, rem, nil
+
+	case reflect.Struct:
+		tags, err := structTags(t)
+		if err != nil {
+			return buf, rem, err
+		}
+		for i := 0; i < t.NumField(); i++ {
+			tag := fieldTag{}
+			if tags != nil {
+				tag = tags[i]
+			}
+			if buf, rem, err = codec.skipTagged(t.Field(i).Type, tag, buf, rem, depth+1); err != nil {
+				return buf, rem, err
+			}
+		}
+		return buf, rem, nil
+	}
+
+	return buf, rem, NewErrUnsupportedUnmarshalType(reflect.New(t).Interface())
+}
+
+// skipLen skips the length prefix of a string, slice, or map, and consumes the
+// remaining memory quota that would be consumed by allocating it.
+func (codec *Codec) skipLen(t reflect.Type, dst *uint32, buf []byte, rem int) ([]byte, int, error) {
+	size := 1
+	switch {
+	case t == bytesType:
+	case t.Kind() == reflect.Map:
+		size = int(t.Key().Size() + t.Elem().Size())
+	default:
+		size = int(t.Elem().Size())
+	}
+	buf, rem, err := codec.unmarshalLen(dst, size, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	return buf, rem - int(*dst)*size, nil
+}
+
+// skipElems skips n consecutive values of the given type.
+func (codec *Codec) skipElems(t reflect.Type, n int, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if size, ok := codec.fixedSize(t); ok {
+		if n > 0 && depth+fixedDepth(t) > codec.opts.MaxDepth {
+			return buf, rem, ErrMaxDepthExceeded
+		}
+		total := uint64(size) * uint64(n)
+		if uint64(len(buf)) < total || uint64(rem) < total {
+			return buf, rem, ErrUnexpectedEndOfBuffer
+		}
+		return buf[total:], rem - int(total), nil
+	}
+	var err error
+	for i := 0; i < n; i++ {
+		if buf, rem, err = codec.skipReflected(t, buf, rem, depth); err != nil {
+			return buf, rem, err
+		}
+	}
+	return buf, rem, nil
+}
+
+// skipTagged skips a value, taking its struct tag into account.
+func (codec *Codec) skipTagged(t reflect.Type, tag fieldTag, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if tag.isZero() {
+		return codec.skipReflected(t, buf, rem, depth)
+	}
+	if tag.fixed > 0 {
+		if len(buf) < tag.fixed || rem < tag.fixed {
+			return buf, rem, ErrUnexpectedEndOfBuffer
+		}
+		return buf[tag.fixed:], rem - tag.fixed, nil
+	}
+	if tag.maxLen > 0 && len(buf) >= SizeHintU32 && uint64(codec.opts.ByteOrder.Uint32(buf)) > uint64(tag.maxLen) {
+		return buf, rem, ErrMaxLenExceeded
+	}
+	return codec.skipReflected(t, buf, rem, depth)
+}
+
+// fixedSize returns the number of bytes in the binary representation of all
+// values of the given type, if this number is the same for all values, and if
+// the values can be skipped without being checked.
+func (codec *Codec) fixedSize(t reflect.Type) (int, bool) {
+	if hasCustomUnmarshaler(t) {
+		return 0, false
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return SizeHintBool, !codec.opts.Strict
+	case reflect.Uint8, reflect.Int8:
+		return SizeHintU8, true
+	case reflect.Uint16, reflect.Int16:
+		return SizeHintU16, true
+	case reflect.Uint32, reflect.Int32, reflect.Float32:
+		return SizeHintU32, true
+	case reflect.Uint64, reflect.Int64, reflect.Float64:
+		return SizeHintU64, true
+	case reflect.Array:
+		// Arrays require at least one byte per element, even when their
+		// elements are empty, so they are only skipped in bulk when their
+		// elements are not empty.
+		size, ok := codec.fixedSize(t.Elem())
+		return size * t.Len(), ok && size > 0
+	case reflect.Struct:
+		tags, err := structTags(t)
+		if err != nil {
+			return 0, false
+		}
+		total := 0
+		for i := 0; i < t.NumField(); i++ {
+			if tags != nil && !tags[i].isZero() {
+				if tags[i].fixed == 0 {
+					return 0, false
+				}
+				total += tags[i].fixed
+				continue
+			}
+			size, ok := codec.fixedSize(t.Field(i).Type)
+			if !ok {
+				return 0, false
+			}
+			total += size
+		}
+		return total, true
+	}
+	return 0, false
+}
+
+// fixedDepth returns the number of levels of nesting that are visited when
+// unmarshaling a value of a fixed size type (one, for values that are not
+// arrays or structs). Fields with a fixed length tag are not visited.
+func fixedDepth(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Array:
+		if t.Len() == 0 {
+			return 1
+		}
+		return 1 + fixedDepth(t.Elem())
+	case reflect.Struct:
+		tags, _ := structTags(t)
+		depth := 0
+		for i := 0; i < t.NumField(); i++ {
+			if tags != nil && !tags[i].isZero() {
+				continue
+			}
+			if d := fixedDepth(t.Field(i).Type); d > depth {
+				depth = d
+			}
+		}
+		return 1 + depth
+	}
+	return 1
+}
+
+// hasCustomUnmarshaler returns true if values of the type are unmarshaled by a
+// custom implementation.
+func hasCustomUnmarshaler(t reflect.Type) bool {
+	ptr := reflect.PtrTo(t)
+	return ptr.NumMethod() > 0 && (ptr.Implements(unmarshaler) || ptr.Implements(unmarshalerWithOptions))
+}
+
+// parsePath splits a path into field names, and bracketed indices or keys.
+func parsePath(path string) ([]string, error) {
+	elems := []string{}
+	for len(path) > 0 {
+		switch path[0] {
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if len(path) > 1 && path[1] == '"' {
+				// Quoted keys can contain brackets, so the closing bracket
+				// is found after the end of the quoted key.
+				quoted, err := strconv.QuotedPrefix(path[1:])
+				if err != nil {
+					return nil, NewErrPathNotFound(fmt.Sprintf("invalid quoted key in %q", path))
+				}
+				end = 1 + len(quoted)
+				if end >= len(path) || path[end] != ']' {
+					end = -1
+				}
+			}
+			if end < 0 {
+				return nil, NewErrPathNotFound(fmt.Sprintf("unterminated bracket in %q", path))
+			}
+			elems = append(elems, path[:end+1])
+			path = path[end+1:]
+		case '.':
+			if len(elems) == 0 {
+				return nil, NewErrPathNotFound(fmt.Sprintf("unexpected . in %q", path))
+			}
+			path = path[1:]
+			fallthrough
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			if end == 0 {
+				return nil, NewErrPathNotFound(fmt.Sprintf("empty field name in %q", path))
+			}
+			elems = append(elems, path[:end])
+			path = path[end:]
+		}
+	}
+	return elems, nil
+}
+
+func parseIndex(elem string) (int, error) {
+	if len(elem) < 2 || elem[0] != '[' {
+		return 0, NewErrPathNotFound(fmt.Sprintf("expected index, got %v", elem))
+	}
+	i, err := strconv.Atoi(elem[1 : len(elem)-1])
+	if err != nil || i < 0 {
+		return 0, NewErrPathNotFound(fmt.Sprintf("expected index, got %v", elem))
+	}
+	return i, nil
+}
+
+var bytesType = reflect.TypeOf([]byte{})
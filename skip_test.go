@@ -0,0 +1,250 @@
+package surge_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type Celsius float32
+
+func (c Celsius) SizeHint() int {
+	return surge.SizeHintF32
+}
+
+func (c Celsius) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalF32(float32(c), buf, rem)
+}
+
+func (c *Celsius) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.UnmarshalF32((*float32)(c), buf, rem)
+}
+
+type Header struct {
+	Height uint64
+	Round  uint32
+	Hash   []byte `surge:"fixed=4"`
+	Flags  [2]bool
+}
+
+type Envelope struct {
+	Header  Header
+	Tags    map[string][]uint16
+	Body    []Triangle
+	Memo    string `surge:"maxlen=64"`
+	Padding []struct{}
+}
+
+func mockEnvelope(r *rand.Rand) Envelope {
+	envelope := Envelope{
+		Header: Header{Height: r.Uint64(), Round: r.Uint32(), Hash: []byte{1, 2, 3, 4}, Flags: [2]bool{true, false}},
+		Tags:   map[string][]uint16{"a": {1, 2}, "b": {}, "c": {3}},
+		Body:   make([]Triangle, r.Intn(10)),
+		Memo:   "memo",
+	}
+	for i := range envelope.Body {
+		envelope.Body[i] = mockTriangle()
+	}
+	return envelope
+}
+
+var _ = Describe("Skip", func() {
+	ts := []reflect.Type{
+		reflect.TypeOf(uint64(0)),
+		reflect.TypeOf(false),
+		reflect.TypeOf(""),
+		reflect.TypeOf([]byte{}),
+		reflect.TypeOf([4]int16{}),
+		reflect.TypeOf([]string{}),
+		reflect.TypeOf([][]float32{}),
+		reflect.TypeOf(map[string][]uint8{}),
+		reflect.TypeOf(MyStruct{}),
+		reflect.TypeOf(Triangle{}),
+		reflect.TypeOf(Model{}),
+	}
+
+	Context("when skipping a value", func() {
+		It("should return the bytes that come after it", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			for _, t := range ts {
+				for trial := 0; trial < 10; trial++ {
+					x, ok := quick.Value(t, r)
+					Expect(ok).To(BeTrue())
+					data, err := surge.ToBinary(x.Interface())
+					Expect(err).ToNot(HaveOccurred())
+					trailing := []byte{1, 2, 3}
+					tail, err := surge.Skip(t, append(data, trailing...))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(tail).To(Equal(trailing))
+				}
+			}
+		})
+
+		It("should skip custom implementations", func() {
+			// Two celsius values, followed by 8 trailing bytes.
+			data := make([]byte, 4+2*4+8)
+			data[3] = 2
+			tail, err := surge.Skip(reflect.TypeOf([]Celsius{}), data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tail).To(HaveLen(8))
+		})
+
+		It("should skip tagged fields", func() {
+			envelope := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			data, err := surge.ToBinary(envelope)
+			Expect(err).ToNot(HaveOccurred())
+			tail, err := surge.Skip(reflect.TypeOf(envelope), data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tail).To(BeEmpty())
+		})
+
+		It("should not allocate", func() {
+			envelope := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			data, err := surge.ToBinary(envelope)
+			Expect(err).ToNot(HaveOccurred())
+			t := reflect.TypeOf(envelope)
+			allocs := testing.AllocsPerRun(10, func() {
+				if _, err := surge.Skip(t, data); err != nil {
+					panic(err)
+				}
+			})
+			Expect(allocs).To(BeZero())
+		})
+	})
+
+	Context("when skipping a value in a buffer that is too small", func() {
+		It("should return the same error as unmarshaling", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			for _, t := range ts {
+				x, ok := quick.Value(t, r)
+				Expect(ok).To(BeTrue())
+				data, err := surge.ToBinary(x.Interface())
+				Expect(err).ToNot(HaveOccurred())
+				for n := 0; n < len(data); n++ {
+					_, skipErr := surge.Skip(t, data[:n])
+					_, _, unmarshalErr := surge.Unmarshal(reflect.New(t).Interface(), data[:n], surge.MaxBytes)
+					Expect(skipErr).To(HaveOccurred())
+					Expect(skipErr).To(Equal(unmarshalErr))
+				}
+			}
+		})
+	})
+
+	Context("when skipping a value that exceeds the max depth", func() {
+		It("should return an error", func() {
+			_, err := surge.Skip(reflect.TypeOf(Tree{}), nestedTreeData(surge.MaxDepth))
+			Expect(err).To(Equal(surge.ErrMaxDepthExceeded))
+		})
+
+		It("should charge the depth of fixed size values", func() {
+			codec := surge.NewCodec(surge.Options{MaxDepth: 4})
+			t := reflect.TypeOf(uint8(0))
+			for depth := 1; depth <= 6; depth++ {
+				wrapped := reflect.StructOf([]reflect.StructField{{Name: "X", Type: t}})
+				for nested, nestedDepth := range map[reflect.Type]int{t: depth, wrapped: depth + 1} {
+					_, skipErr := codec.Skip(nested, []byte{1})
+					_, _, unmarshalErr := codec.Unmarshal(reflect.New(nested).Interface(), []byte{1}, surge.MaxBytes)
+					if nestedDepth <= 4 {
+						Expect(skipErr).ToNot(HaveOccurred(), nested.String())
+						Expect(unmarshalErr).ToNot(HaveOccurred(), nested.String())
+					} else {
+						Expect(skipErr).To(Equal(surge.ErrMaxDepthExceeded), nested.String())
+						Expect(unmarshalErr).To(Equal(surge.ErrMaxDepthExceeded), nested.String())
+					}
+				}
+				t = reflect.ArrayOf(1, t)
+			}
+		})
+	})
+})
+
+var _ = Describe("Locate", func() {
+	Context("when locating a nested value", func() {
+		It("should return the range of its binary representation", func() {
+			envelope := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			envelope.Body = append(envelope.Body, mockTriangle(), mockTriangle())
+			data, err := surge.ToBinary(envelope)
+			Expect(err).ToNot(HaveOccurred())
+
+			t := reflect.TypeOf(envelope)
+			expectations := map[string]interface{}{
+				"":                envelope,
+				"Header":          envelope.Header,
+				"Header.Height":   envelope.Header.Height,
+				"Header.Flags[1]": envelope.Header.Flags[1],
+				"Tags[b]":         envelope.Tags["b"],
+				`Tags["b"]`:       envelope.Tags["b"],
+				"Tags[c][0]":      envelope.Tags["c"][0],
+				"Body[1].B.Z":     envelope.Body[1].B.Z,
+				"Body":            envelope.Body,
+				"Memo":            envelope.Memo,
+			}
+			for path, expected := range expectations {
+				start, end, err := surge.Locate(t, data, path)
+				Expect(err).ToNot(HaveOccurred())
+				expectedData, err := surge.ToBinary(expected)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data[start:end]).To(Equal(expectedData), path)
+			}
+
+			start, end, err := surge.Locate(t, data, "Header.Hash")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data[start:end]).To(Equal([]byte{1, 2, 3, 4}))
+		})
+	})
+
+	Context("when a string key contains brackets or dots", func() {
+		It("should locate the value using the quoted key", func() {
+			tags := map[string][]uint16{"a.b": {1}, "c]": {2, 3}, "": {4}}
+			data, err := surge.ToBinary(tags)
+			Expect(err).ToNot(HaveOccurred())
+
+			t := reflect.TypeOf(tags)
+			for key, expected := range tags {
+				path := fmt.Sprintf("[%q]", key)
+				start, end, err := surge.Locate(t, data, path)
+				Expect(err).ToNot(HaveOccurred())
+				expectedData, err := surge.ToBinary(expected)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data[start:end]).To(Equal(expectedData), path)
+			}
+		})
+	})
+
+	Context("when the path does not exist", func() {
+		It("should return an error", func() {
+			envelope := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			data, err := surge.ToBinary(envelope)
+			Expect(err).ToNot(HaveOccurred())
+
+			t := reflect.TypeOf(envelope)
+			for _, path := range []string{"Footer", "Header.Height.X", "Body[100]", "Body.X", "Tags[z]", "Header.Hash[0]", "Body[", ".Header", "Header..Height", `Tags["b]`, `Tags["b"`, `Tags["z"]`} {
+				_, _, err := surge.Locate(t, data, path)
+				Expect(err).To(BeAssignableToTypeOf(surge.ErrPathNotFound{}), path)
+			}
+		})
+	})
+
+	Context("when the buffer is too small", func() {
+		It("should return an error", func() {
+			envelope := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			data, err := surge.ToBinary(envelope)
+			Expect(err).ToNot(HaveOccurred())
+
+			t := reflect.TypeOf(envelope)
+			_, end, err := surge.Locate(t, data, "Memo")
+			Expect(err).ToNot(HaveOccurred())
+			for n := 0; n < end; n++ {
+				_, _, err := surge.Locate(t, data[:n], "Memo")
+				Expect(err).To(Equal(surge.ErrUnexpectedEndOfBuffer))
+			}
+		})
+	})
+})
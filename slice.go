@@ -1,6 +1,7 @@
 package surge
 
 import (
+	"fmt"
 	"reflect"
 )
 
@@ -52,32 +53,68 @@ func UnmarshalBytes(v *[]byte, buf []byte, rem int) ([]byte, int, error) {
 	return buf, rem, nil
 }
 
-func sizeHintReflectedSlice(v reflect.Value) int {
+func (codec *Codec) marshalBytes(v []byte, buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := codec.marshalLen(len(v), buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	if len(buf) < len(v) || rem < len(v) {
+		return buf, rem, ErrUnexpectedEndOfBuffer
+	}
+	copy(buf, v)
+	buf = buf[len(v):]
+	rem -= len(v)
+	return buf, rem, nil
+}
+
+func (codec *Codec) unmarshalBytes(v *[]byte, buf []byte, rem int) ([]byte, int, error) {
+	vLen := uint32(0)
+	buf, rem, err := codec.unmarshalLen(&vLen, 1, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+
+	if len(buf) < int(vLen) {
+		return buf, rem, ErrUnexpectedEndOfBuffer
+	}
+	if codec.opts.ZeroCopy {
+		*v = buf[:vLen:vLen]
+	} else {
+		*v = make([]byte, vLen)
+		copy(*v, buf)
+	}
+	buf = buf[vLen:]
+	rem -= int(vLen)
+
+	return buf, rem, nil
+}
+
+func (codec *Codec) sizeHintReflectedSlice(v reflect.Value, depth int) int {
 	sizeHint := SizeHintU32
 	for i := 0; i < v.Len(); i++ {
-		sizeHint += sizeHintReflected(v.Index(i))
+		sizeHint += codec.sizeHintReflected(v.Index(i), depth+1)
 	}
 	return sizeHint
 }
 
-func marshalReflectedSlice(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
-	buf, rem, err := MarshalLen(uint32(v.Len()), buf, rem)
+func (codec *Codec) marshalReflectedSlice(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	buf, rem, err := codec.marshalLen(v.Len(), buf, rem)
 	if err != nil {
 		return buf, rem, err
 	}
 	for i := 0; i < v.Len(); i++ {
-		if buf, rem, err = marshalReflected(v.Index(i), buf, rem); err != nil {
+		if buf, rem, err = codec.marshalReflected(v.Index(i), buf, rem, depth+1); err != nil {
 			return buf, rem, err
 		}
 	}
 	return buf, rem, nil
 }
 
-func unmarshalReflectedSlice(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
+func (codec *Codec) unmarshalReflectedSlice(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
 	sliceLen := uint32(0)
 	elem := v.Elem()
 	size := int(elem.Type().Elem().Size())
-	buf, rem, err := UnmarshalLen(&sliceLen, size, buf, rem)
+	buf, rem, err := codec.unmarshalLen(&sliceLen, size, buf, rem)
 	if err != nil {
 		return buf, rem, err
 	}
@@ -85,8 +122,8 @@ func unmarshalReflectedSlice(v reflect.Value, buf []byte, rem int) ([]byte, int,
 
 	elem.Set(reflect.MakeSlice(elem.Type(), int(sliceLen), int(sliceLen)))
 	for i := uint32(0); i < sliceLen; i++ {
-		if buf, rem, err = unmarshalReflected(elem.Index(int(i)).Addr(), buf, rem); err != nil {
-			return buf, rem, err
+		if buf, rem, err = codec.unmarshalReflected(elem.Index(int(i)).Addr(), buf, rem, depth+1); err != nil {
+			return buf, rem, withPathPrefix(err, fmt.Sprintf("[%d]", i))
 		}
 	}
 	return buf, rem, nil
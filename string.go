@@ -42,3 +42,30 @@ func UnmarshalString(v *string, buf []byte, rem int) ([]byte, int, error) {
 	*v = string(strBuf)
 	return bufRem, rem - n, nil
 }
+
+func (codec *Codec) marshalString(v string, buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := codec.marshalLen(len(v), buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	if len(buf) < len(v) || rem < len(v) {
+		return buf, rem, ErrUnexpectedEndOfBuffer
+	}
+	n := copy(buf, v)
+	return buf[n:], rem - n, nil
+}
+
+func (codec *Codec) unmarshalString(v *string, buf []byte, rem int) ([]byte, int, error) {
+	strLen := uint32(0)
+	buf, rem, err := codec.unmarshalLen(&strLen, 1, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	n := int(strLen)
+	if len(buf) < n {
+		return buf, rem, ErrUnexpectedEndOfBuffer
+	}
+	strBuf, bufRem := buf[:n], buf[n:]
+	*v = string(strBuf)
+	return bufRem, rem - n, nil
+}
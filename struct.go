@@ -4,23 +4,38 @@ import (
 	"reflect"
 )
 
-func sizeHintReflectedStruct(v reflect.Value) int {
+func (codec *Codec) sizeHintReflectedStruct(v reflect.Value, depth int) int {
+	// Invalid struct tags are ignored, because they will cause an error during
+	// marshaling anyway.
+	tags, _ := structTags(v.Type())
 	sizeHint := 0
 	numField := v.NumField()
 	for i := 0; i < numField; i++ {
 		if f := v.Field(i); f.IsValid() {
-			sizeHint += sizeHintReflected(f)
+			if tags != nil && !tags[i].isZero() {
+				sizeHint += codec.sizeHintTagged(f, tags[i], depth+1)
+			} else {
+				sizeHint += codec.sizeHintReflected(f, depth+1)
+			}
 		}
 	}
 	return sizeHint
 }
 
-func marshalReflectedStruct(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
-	var err error
+func (codec *Codec) marshalReflectedStruct(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	tags, err := structTags(v.Type())
+	if err != nil {
+		return buf, rem, err
+	}
 	numField := v.NumField()
 	for i := 0; i < numField; i++ {
 		if f := v.Field(i); f.IsValid() {
-			if buf, rem, err = marshalReflected(f, buf, rem); err != nil {
+			if tags != nil && !tags[i].isZero() {
+				buf, rem, err = codec.marshalTagged(f, tags[i], buf, rem, depth+1)
+			} else {
+				buf, rem, err = codec.marshalReflected(f, buf, rem, depth+1)
+			}
+			if err != nil {
 				return buf, rem, err
 			}
 		}
@@ -28,14 +43,22 @@ func marshalReflectedStruct(v reflect.Value, buf []byte, rem int) ([]byte, int,
 	return buf, rem, nil
 }
 
-func unmarshalReflectedStruct(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
-	var err error
+func (codec *Codec) unmarshalReflectedStruct(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
 	elem := v.Elem()
+	tags, err := structTags(elem.Type())
+	if err != nil {
+		return buf, rem, err
+	}
 	numField := elem.NumField()
 	for i := 0; i < numField; i++ {
 		if f := elem.Field(i); f.IsValid() {
-			if buf, rem, err = unmarshalReflected(f.Addr(), buf, rem); err != nil {
-				return buf, rem, err
+			if tags != nil && !tags[i].isZero() {
+				buf, rem, err = codec.unmarshalTagged(f.Addr(), tags[i], buf, rem, depth+1)
+			} else {
+				buf, rem, err = codec.unmarshalReflected(f.Addr(), buf, rem, depth+1)
+			}
+			if err != nil {
+				return buf, rem, withPathPrefix(err, elem.Type().Field(i).Name)
 			}
 		}
 	}
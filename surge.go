@@ -1,6 +1,7 @@
 package surge
 
 import (
+	"math"
 	"reflect"
 	"unsafe"
 )
@@ -8,6 +9,13 @@ import (
 // MaxBytes is set to 64 MB by default.
 const MaxBytes = int(64 * 1024 * 1024)
 
+// MaxDepth is the maximum nesting depth of a value, and is set to 256 by
+// default. Every array, slice, map, struct, and pointer introduces one level of
+// nesting, and values nested MaxDepth levels deep are rejected. It protects
+// against malicious inputs that nest recursive types deeply enough to exhaust
+// the stack.
+const MaxDepth = 256
+
 // A SizeHinter can hint at the number of bytes required to represented it in
 // binary.
 type SizeHinter interface {
@@ -30,6 +38,15 @@ type Unmarshaler interface {
 	Unmarshal(buf []byte, rem int) ([]byte, int, error)
 }
 
+// A Validator can validate itself after it has been unmarshaled. When
+// unmarshaling, Validate is called on every value that implements the Validator
+// interface, immediately after that value has been unmarshaled. This means that
+// nested values are validated before the values that contain them.
+type Validator interface {
+	// Validate this value, returning an error if it is invalid.
+	Validate() error
+}
+
 // A MarshalUnmarshaler is a marshaler and an unmarshaler.
 type MarshalUnmarshaler interface {
 	Marshaler
@@ -40,17 +57,14 @@ type MarshalUnmarshaler interface {
 // memory quota to restrict the number of bytes that will be allocated during
 // marshaling.
 func ToBinary(v interface{}) ([]byte, error) {
-	buf := make([]byte, SizeHint(v))
-	_, _, err := Marshal(v, buf, MaxBytes)
-	return buf, err
+	return defaultCodec.ToBinary(v)
 }
 
 // FromBinary unmarshals a byte representation of a value to a pointer to that
 // value. In uses the maximum memory quota to restrict the number of bytes that
 // will be allocated during unmarshaling.
 func FromBinary(v interface{}, buf []byte) error {
-	_, _, err := Unmarshal(v, buf, MaxBytes)
-	return err
+	return defaultCodec.FromBinary(v, buf)
 }
 
 // SizeHint returns the number of bytes required to store a value in its binary
@@ -60,7 +74,8 @@ func FromBinary(v interface{}, buf []byte) error {
 // all scalars, strings, arrays, slices, maps, structs, and custom
 // implementations (for types that implement the SizeHinter interface). If the
 // type is not supported, then zero is returned. If the value is a pointer, then
-// the size of the underlying value being pointed to will be returned.
+// the size of the underlying value being pointed to will be returned. Values
+// nested deeper than MaxDepth are not counted.
 //
 //  x := int64(0)
 //  sizeHint := surge.SizeHint(x)
@@ -69,7 +84,7 @@ func FromBinary(v interface{}, buf []byte) error {
 //  }
 //
 func SizeHint(v interface{}) int {
-	return sizeHintReflected(reflect.ValueOf(v))
+	return defaultCodec.SizeHint(v)
 }
 
 // Marshal a value into its binary representation, and store the value in a byte
@@ -82,6 +97,7 @@ func SizeHint(v interface{}) int {
 // remaining memory quota, are returned. If the byte slice is too small, then an
 // error is returned. Similarly, if the remaining memory quote is too small,
 // then an error is returned. If the type is not supported, then an error is
+// returned. If the value is nested deeper than MaxDepth, then an error is
 // returned. An error does not imply that nothing from the byte slice, or
 // remaining memory quota, was consumed. If the value is a pointer, then the
 // underlying value being pointed to will be marshaled.
@@ -100,7 +116,7 @@ func SizeHint(v interface{}) int {
 //  }
 //
 func Marshal(v interface{}, buf []byte, rem int) ([]byte, int, error) {
-	return marshalReflected(reflect.ValueOf(v), buf, rem)
+	return defaultCodec.Marshal(v, buf, rem)
 }
 
 // Unmarshal a value from its binary representation by reading from a byte
@@ -114,9 +130,12 @@ func Marshal(v interface{}, buf []byte, rem int) ([]byte, int, error) {
 // of the byte slice, and the remaining memory quota, are returned. If the byte
 // slice is too small, then an error is returned. Similarly, if the remaining
 // memory quote is too small, then an error is returned. If the type is not a
-// pointer to one of the supported types, then an error is returned. An error
-// does not imply that nothing from the byte slice, or remaining memory quota,
-// was consumed. If the value is not a pointer, then an error is returned.
+// pointer to one of the supported types, then an error is returned. If the
+// value is nested deeper than MaxDepth, then an error is returned. If a value
+// implements the Validator interface, and is invalid, then an ErrValidation is
+// returned. An error does not imply that nothing from the byte slice, or
+// remaining memory quota, was consumed. If the value is not a pointer, then an
+// error is returned.
 //
 //  x := int64(0)
 //  buf := make([]byte, 8)
@@ -132,18 +151,24 @@ func Marshal(v interface{}, buf []byte, rem int) ([]byte, int, error) {
 //  }
 //
 func Unmarshal(v interface{}, buf []byte, rem int) ([]byte, int, error) {
-	valueOf := reflect.ValueOf(v)
-	if valueOf.Kind() != reflect.Ptr {
-		return buf, rem, NewErrUnsupportedUnmarshalType(v)
-	}
-	return unmarshalReflected(valueOf, buf, rem)
+	return defaultCodec.Unmarshal(v, buf, rem)
 }
 
-func sizeHintReflected(v reflect.Value) int {
-	if v.Type().Implements(sizeHinter) {
+func (codec *Codec) sizeHintReflected(v reflect.Value, depth int) int {
+	if depth >= codec.opts.MaxDepth {
+		return 0
+	}
+	// Checking for custom implementations is expensive, so it is skipped for
+	// types that have no methods.
+	if t := v.Type(); t.NumMethod() > 0 && t.Implements(sizeHinter) {
 		return v.Interface().(SizeHinter).SizeHint()
 	}
+	return codec.sizeHintKind(v, depth)
+}
 
+// sizeHintKind returns the size hint of a value based on its kind, ignoring any
+// custom implementation of the value itself (but not of its elements).
+func (codec *Codec) sizeHintKind(v reflect.Value, depth int) int {
 	switch v.Kind() {
 	case reflect.Bool:
 		return SizeHintBool
@@ -175,20 +200,20 @@ func sizeHintReflected(v reflect.Value) int {
 		return SizeHintString(v.String())
 
 	case reflect.Array:
-		return sizeHintReflectedArray(v)
+		return codec.sizeHintReflectedArray(v, depth)
 	case reflect.Slice:
 		if v, ok := v.Interface().([]byte); ok {
 			return SizeHintBytes(v)
 		}
-		return sizeHintReflectedSlice(v)
+		return codec.sizeHintReflectedSlice(v, depth)
 	case reflect.Map:
-		return sizeHintReflectedMap(v)
+		return codec.sizeHintReflectedMap(v, depth)
 	case reflect.Struct:
-		return sizeHintReflectedStruct(v)
+		return codec.sizeHintReflectedStruct(v, depth)
 	case reflect.Ptr:
 		v = reflect.Indirect(v)
 		if v.IsValid() {
-			return sizeHintReflected(v)
+			return codec.sizeHintReflected(v, depth+1)
 		}
 		return 0
 	}
@@ -196,56 +221,69 @@ func sizeHintReflected(v reflect.Value) int {
 	return 0
 }
 
-func marshalReflected(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
-	if v.Type().Implements(marshaler) {
-		return v.Interface().(Marshaler).Marshal(buf, rem)
+func (codec *Codec) marshalReflected(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if depth >= codec.opts.MaxDepth {
+		return buf, rem, ErrMaxDepthExceeded
 	}
+	if t := v.Type(); t.NumMethod() > 0 {
+		if t.Implements(marshalerWithOptions) {
+			return v.Interface().(MarshalerWithOptions).MarshalWithOptions(buf, rem, codec.optionsAt(depth))
+		}
+		if t.Implements(marshaler) {
+			return v.Interface().(Marshaler).Marshal(buf, rem)
+		}
+	}
+	return codec.marshalKind(v, buf, rem, depth)
+}
 
+// marshalKind marshals a value based on its kind, ignoring any custom
+// implementation of the value itself (but not of its elements).
+func (codec *Codec) marshalKind(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
 	switch v.Kind() {
 	case reflect.Bool:
-		return MarshalBool(v.Bool(), buf, rem)
+		return codec.marshalBool(v.Bool(), buf, rem)
 
 	case reflect.Uint8:
-		return MarshalU8(uint8(v.Uint()), buf, rem)
+		return codec.marshalUint(v.Uint(), SizeHintU8, buf, rem)
 	case reflect.Uint16:
-		return MarshalU16(uint16(v.Uint()), buf, rem)
+		return codec.marshalUint(v.Uint(), SizeHintU16, buf, rem)
 	case reflect.Uint32:
-		return MarshalU32(uint32(v.Uint()), buf, rem)
+		return codec.marshalUint(v.Uint(), SizeHintU32, buf, rem)
 	case reflect.Uint, reflect.Uint64:
-		return MarshalU64(uint64(v.Uint()), buf, rem)
+		return codec.marshalUint(v.Uint(), SizeHintU64, buf, rem)
 
 	case reflect.Int8:
-		return MarshalI8(int8(v.Int()), buf, rem)
+		return codec.marshalUint(uint64(v.Int()), SizeHintI8, buf, rem)
 	case reflect.Int16:
-		return MarshalI16(int16(v.Int()), buf, rem)
+		return codec.marshalUint(uint64(v.Int()), SizeHintI16, buf, rem)
 	case reflect.Int32:
-		return MarshalI32(int32(v.Int()), buf, rem)
+		return codec.marshalUint(uint64(v.Int()), SizeHintI32, buf, rem)
 	case reflect.Int64:
-		return MarshalI64(int64(v.Int()), buf, rem)
+		return codec.marshalUint(uint64(v.Int()), SizeHintI64, buf, rem)
 
 	case reflect.Float32:
-		return MarshalF32(float32(v.Float()), buf, rem)
+		return codec.marshalUint(uint64(float32Bits(v)), SizeHintF32, buf, rem)
 	case reflect.Float64:
-		return MarshalF64(float64(v.Float()), buf, rem)
+		return codec.marshalUint(math.Float64bits(v.Float()), SizeHintF64, buf, rem)
 
 	case reflect.String:
-		return MarshalString(v.String(), buf, rem)
+		return codec.marshalString(v.String(), buf, rem)
 
 	case reflect.Array:
-		return marshalReflectedArray(v, buf, rem)
+		return codec.marshalReflectedArray(v, buf, rem, depth)
 	case reflect.Slice:
 		if v, ok := v.Interface().([]byte); ok {
-			return MarshalBytes(v, buf, rem)
+			return codec.marshalBytes(v, buf, rem)
 		}
-		return marshalReflectedSlice(v, buf, rem)
+		return codec.marshalReflectedSlice(v, buf, rem, depth)
 	case reflect.Map:
-		return marshalReflectedMap(v, buf, rem)
+		return codec.marshalReflectedMap(v, buf, rem, depth)
 	case reflect.Struct:
-		return marshalReflectedStruct(v, buf, rem)
+		return codec.marshalReflectedStruct(v, buf, rem, depth)
 	case reflect.Ptr:
 		v = reflect.Indirect(v)
 		if v.IsValid() {
-			return marshalReflected(v, buf, rem)
+			return codec.marshalReflected(v, buf, rem, depth+1)
 		}
 		return buf, rem, nil
 	}
@@ -253,59 +291,128 @@ func marshalReflected(v reflect.Value, buf []byte, rem int) ([]byte, int, error)
 	return buf, rem, NewErrUnsupportedMarshalType(v.Interface())
 }
 
-func unmarshalReflected(v reflect.Value, buf []byte, rem int) ([]byte, int, error) {
-	if v.Type().Implements(unmarshaler) {
-		return v.Interface().(Unmarshaler).Unmarshal(buf, rem)
+func (codec *Codec) unmarshalReflected(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if depth >= codec.opts.MaxDepth {
+		return buf, rem, ErrMaxDepthExceeded
+	}
+	buf, rem, err := codec.unmarshalReflectedValue(v, buf, rem, depth)
+	if err != nil {
+		return buf, rem, err
+	}
+	return buf, rem, validate(v)
+}
+
+// validate a value that has been unmarshaled, if it implements the Validator
+// interface.
+func validate(v reflect.Value) error {
+	if t := v.Type(); t.NumMethod() > 0 && t.Implements(validator) {
+		if err := v.Interface().(Validator).Validate(); err != nil {
+			return NewErrValidation(err)
+		}
+	}
+	return nil
+}
+
+func (codec *Codec) unmarshalReflectedValue(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if t := v.Type(); t.NumMethod() > 0 {
+		if t.Implements(unmarshalerWithOptions) {
+			return v.Interface().(UnmarshalerWithOptions).UnmarshalWithOptions(buf, rem, codec.optionsAt(depth))
+		}
+		if t.Implements(unmarshaler) {
+			return v.Interface().(Unmarshaler).Unmarshal(buf, rem)
+		}
 	}
+	return codec.unmarshalKind(v, buf, rem, depth)
+}
+
+// unmarshalKind unmarshals a value based on its kind, ignoring any custom
+// implementation of the value itself (but not of its elements).
+func (codec *Codec) unmarshalKind(v reflect.Value, buf []byte, rem int, depth int) ([]byte, int, error) {
+	var x uint64
+	var err error
+	ptr := unsafe.Pointer(v.Pointer())
 
 	switch v.Type().Elem().Kind() {
 	case reflect.Bool:
-		return UnmarshalBool((*bool)(unsafe.Pointer(v.Pointer())), buf, rem)
+		return codec.unmarshalBool((*bool)(ptr), buf, rem)
 
 	case reflect.Uint8:
-		return UnmarshalU8((*uint8)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintU8, buf, rem); err == nil {
+			*(*uint8)(ptr) = uint8(x)
+		}
+		return buf, rem, err
 	case reflect.Uint16:
-		return UnmarshalU16((*uint16)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintU16, buf, rem); err == nil {
+			*(*uint16)(ptr) = uint16(x)
+		}
+		return buf, rem, err
 	case reflect.Uint32:
-		return UnmarshalU32((*uint32)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintU32, buf, rem); err == nil {
+			*(*uint32)(ptr) = uint32(x)
+		}
+		return buf, rem, err
 	case reflect.Uint64:
-		return UnmarshalU64((*uint64)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintU64, buf, rem); err == nil {
+			*(*uint64)(ptr) = x
+		}
+		return buf, rem, err
 
 	case reflect.Int8:
-		return UnmarshalI8((*int8)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintI8, buf, rem); err == nil {
+			*(*int8)(ptr) = int8(x)
+		}
+		return buf, rem, err
 	case reflect.Int16:
-		return UnmarshalI16((*int16)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintI16, buf, rem); err == nil {
+			*(*int16)(ptr) = int16(x)
+		}
+		return buf, rem, err
 	case reflect.Int32:
-		return UnmarshalI32((*int32)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintI32, buf, rem); err == nil {
+			*(*int32)(ptr) = int32(x)
+		}
+		return buf, rem, err
 	case reflect.Int64:
-		return UnmarshalI64((*int64)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintI64, buf, rem); err == nil {
+			*(*int64)(ptr) = int64(x)
+		}
+		return buf, rem, err
 
 	case reflect.Float32:
-		return UnmarshalF32((*float32)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintF32, buf, rem); err == nil {
+			*(*float32)(ptr) = math.Float32frombits(uint32(x))
+		}
+		return buf, rem, err
 	case reflect.Float64:
-		return UnmarshalF64((*float64)(unsafe.Pointer(v.Pointer())), buf, rem)
+		if x, buf, rem, err = codec.unmarshalUint(SizeHintF64, buf, rem); err == nil {
+			*(*float64)(ptr) = math.Float64frombits(x)
+		}
+		return buf, rem, err
 
 	case reflect.String:
-		return UnmarshalString((*string)(unsafe.Pointer(v.Pointer())), buf, rem)
+		return codec.unmarshalString((*string)(ptr), buf, rem)
 
 	case reflect.Array:
-		return unmarshalReflectedArray(v, buf, rem)
+		return codec.unmarshalReflectedArray(v, buf, rem, depth)
 	case reflect.Slice:
 		if v, ok := v.Interface().(*[]byte); ok {
-			return UnmarshalBytes(v, buf, rem)
+			return codec.unmarshalBytes(v, buf, rem)
 		}
-		return unmarshalReflectedSlice(v, buf, rem)
+		return codec.unmarshalReflectedSlice(v, buf, rem, depth)
 	case reflect.Map:
-		return unmarshalReflectedMap(v, buf, rem)
+		return codec.unmarshalReflectedMap(v, buf, rem, depth)
 	case reflect.Struct:
-		return unmarshalReflectedStruct(v, buf, rem)
+		return codec.unmarshalReflectedStruct(v, buf, rem, depth)
 	}
 
 	return buf, rem, NewErrUnsupportedUnmarshalType(v.Interface())
 }
 
 var (
-	sizeHinter  = reflect.ValueOf((*SizeHinter)(nil)).Type().Elem()
-	marshaler   = reflect.ValueOf((*Marshaler)(nil)).Type().Elem()
-	unmarshaler = reflect.ValueOf((*Unmarshaler)(nil)).Type().Elem()
+	sizeHinter             = reflect.ValueOf((*SizeHinter)(nil)).Type().Elem()
+	marshaler              = reflect.ValueOf((*Marshaler)(nil)).Type().Elem()
+	unmarshaler            = reflect.ValueOf((*Unmarshaler)(nil)).Type().Elem()
+	marshalerWithOptions   = reflect.ValueOf((*MarshalerWithOptions)(nil)).Type().Elem()
+	unmarshalerWithOptions = reflect.ValueOf((*UnmarshalerWithOptions)(nil)).Type().Elem()
+	validator              = reflect.ValueOf((*Validator)(nil)).Type().Elem()
 )
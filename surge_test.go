@@ -3,6 +3,8 @@ package surge_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/rand"
 	"testing"
 	"testing/quick"
@@ -145,6 +147,25 @@ func BenchmarkModelMarshal(b *testing.B) {
 	}
 }
 
+func BenchmarkModelMarshalTyped(b *testing.B) {
+	buf := [surge.MaxBytes]byte{}
+	codec, err := surge.NewTypedCodec[Model](surge.DefaultOptions())
+	if err != nil {
+		b.Fatal(err)
+	}
+	models := make([]Model, b.N)
+	for i := range models {
+		models[i] = mockModel()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := codec.Marshal(models[i], buf[:], surge.MaxBytes)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 type Foo struct {
 	Name     string
 	BirthDay time.Time
@@ -288,3 +309,226 @@ var _ = Describe("Unmarshal", func() {
 		})
 	})
 })
+
+type Tree struct {
+	Children []Tree
+}
+
+func nestedTree(depth int) Tree {
+	tree := Tree{Children: []Tree{}}
+	for i := 0; i < depth; i++ {
+		tree = Tree{Children: []Tree{tree}}
+	}
+	return tree
+}
+
+func nestedTreeData(depth int) []byte {
+	data := make([]byte, 0, 4*(depth+1))
+	for i := 0; i < depth; i++ {
+		data = append(data, 0, 0, 0, 1)
+	}
+	return append(data, 0, 0, 0, 0)
+}
+
+var _ = Describe("Max depth", func() {
+	Context("when marshaling and unmarshaling values nested within the max depth", func() {
+		It("should succeed", func() {
+			tree := nestedTree(surge.MaxDepth / 4)
+			data, err := surge.ToBinary(tree)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(nestedTreeData(surge.MaxDepth / 4)))
+
+			tree2 := Tree{}
+			Expect(surge.FromBinary(&tree2, data)).To(Succeed())
+			Expect(tree2).To(Equal(tree))
+		})
+	})
+
+	Context("when size hinting values nested beyond the max depth", func() {
+		It("should not count the values beyond the max depth", func() {
+			Expect(surge.SizeHint(nestedTree(surge.MaxDepth))).To(BeNumerically("<", len(nestedTreeData(surge.MaxDepth))))
+		})
+	})
+
+	Context("when marshaling values nested beyond the max depth", func() {
+		It("should return an error", func() {
+			tree := nestedTree(surge.MaxDepth)
+			buf := make([]byte, len(nestedTreeData(surge.MaxDepth)))
+			_, _, err := surge.Marshal(tree, buf, surge.MaxBytes)
+			Expect(err).To(Equal(surge.ErrMaxDepthExceeded))
+		})
+	})
+
+	Context("when unmarshaling values nested beyond the max depth", func() {
+		It("should return an error", func() {
+			tree := Tree{}
+			Expect(surge.FromBinary(&tree, nestedTreeData(surge.MaxDepth))).To(Equal(surge.ErrMaxDepthExceeded))
+		})
+
+		It("should not exhaust the stack for deeply nested malicious inputs", func() {
+			tree := Tree{}
+			Expect(surge.FromBinary(&tree, nestedTreeData(surge.MaxBytes/8))).To(Equal(surge.ErrMaxDepthExceeded))
+		})
+	})
+})
+
+type Vote struct {
+	Round     uint8
+	Signature []byte
+}
+
+func (vote Vote) Validate() error {
+	if len(vote.Signature) == 0 {
+		return fmt.Errorf("empty signature")
+	}
+	return nil
+}
+
+type Block struct {
+	Height uint64
+	Votes  []Vote
+	Tally  map[string]Vote
+}
+
+type OrderedVotes []Vote
+
+func (votes OrderedVotes) Validate() error {
+	for i := 1; i < len(votes); i++ {
+		if votes[i-1].Round >= votes[i].Round {
+			return fmt.Errorf("unordered rounds")
+		}
+	}
+	return nil
+}
+
+type Round uint8
+
+func (round Round) Validate() error {
+	if round == 7 {
+		return fmt.Errorf("unlucky round")
+	}
+	return nil
+}
+
+type CompressedKey []byte
+
+func (key CompressedKey) Validate() error {
+	if key[0] != 0x02 && key[0] != 0x03 {
+		return fmt.Errorf("bad prefix")
+	}
+	return nil
+}
+
+type Signer struct {
+	Key CompressedKey `surge:"fixed=3"`
+}
+
+var validationOrder []string
+
+type OrderedParent struct {
+	Child OrderedChild
+}
+
+func (OrderedParent) Validate() error {
+	validationOrder = append(validationOrder, "parent")
+	return nil
+}
+
+type OrderedChild struct{}
+
+func (OrderedChild) Validate() error {
+	validationOrder = append(validationOrder, "child")
+	return nil
+}
+
+var _ = Describe("Validator", func() {
+	validBlock := func() Block {
+		return Block{
+			Height: 1,
+			Votes:  []Vote{{Round: 0, Signature: []byte{1}}, {Round: 1, Signature: []byte{2}}},
+			Tally:  map[string]Vote{"alice": {Round: 0, Signature: []byte{3}}},
+		}
+	}
+
+	Context("when unmarshaling valid values", func() {
+		It("should succeed", func() {
+			block := validBlock()
+			data, err := surge.ToBinary(block)
+			Expect(err).ToNot(HaveOccurred())
+			block2 := Block{}
+			Expect(surge.FromBinary(&block2, data)).To(Succeed())
+			Expect(block2).To(Equal(block))
+		})
+	})
+
+	Context("when unmarshaling invalid values", func() {
+		It("should return an error with the path to the invalid value", func() {
+			block := validBlock()
+			block.Votes[1].Signature = nil
+			data, err := surge.ToBinary(block)
+			Expect(err).ToNot(HaveOccurred())
+			err = surge.FromBinary(&Block{}, data)
+			Expect(err).To(Equal(surge.ErrValidation{Path: "Votes[1]", Err: fmt.Errorf("empty signature")}))
+			Expect(err.Error()).To(Equal("validation error at Votes[1]: empty signature"))
+
+			block = validBlock()
+			block.Tally["alice"] = Vote{}
+			data, err = surge.ToBinary(block)
+			Expect(err).ToNot(HaveOccurred())
+			err = surge.FromBinary(&Block{}, data)
+			Expect(err).To(Equal(surge.ErrValidation{Path: `Tally["alice"]`, Err: fmt.Errorf("empty signature")}))
+
+			data, err = surge.ToBinary(Vote{})
+			Expect(err).ToNot(HaveOccurred())
+			err = surge.FromBinary(&Vote{}, data)
+			Expect(err).To(Equal(surge.ErrValidation{Path: "", Err: fmt.Errorf("empty signature")}))
+			Expect(errors.Unwrap(err)).To(Equal(fmt.Errorf("empty signature")))
+		})
+
+		It("should identify invalid map keys by their key", func() {
+			data, err := surge.ToBinary(map[Round]uint8{1: 1, 7: 2})
+			Expect(err).ToNot(HaveOccurred())
+			err = surge.FromBinary(&map[Round]uint8{}, data)
+			Expect(err).To(Equal(surge.ErrValidation{Path: "[7].key", Err: fmt.Errorf("unlucky round")}))
+
+			data, err = surge.ToBinary(map[uint8]Round{1: 1, 2: 7})
+			Expect(err).ToNot(HaveOccurred())
+			err = surge.FromBinary(&map[uint8]Round{}, data)
+			Expect(err).To(Equal(surge.ErrValidation{Path: "[2]", Err: fmt.Errorf("unlucky round")}))
+		})
+
+		It("should quote string map keys", func() {
+			data, err := surge.ToBinary(map[string]Round{"a].b": 7})
+			Expect(err).ToNot(HaveOccurred())
+			err = surge.FromBinary(&map[string]Round{}, data)
+			Expect(err).To(Equal(surge.ErrValidation{Path: `["a].b"]`, Err: fmt.Errorf("unlucky round")}))
+
+			data, err = surge.ToBinary(map[string]Round{"": 7})
+			Expect(err).ToNot(HaveOccurred())
+			err = surge.FromBinary(&map[string]Round{}, data)
+			Expect(err).To(Equal(surge.ErrValidation{Path: `[""]`, Err: fmt.Errorf("unlucky round")}))
+		})
+
+		It("should validate named slice types", func() {
+			data, err := surge.ToBinary(OrderedVotes{{Round: 1, Signature: []byte{1}}, {Round: 0, Signature: []byte{1}}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(surge.FromBinary(&OrderedVotes{}, data)).To(Equal(surge.ErrValidation{Err: fmt.Errorf("unordered rounds")}))
+		})
+	})
+
+	Context("when unmarshaling invalid values with a fixed length", func() {
+		It("should return an error with the path to the invalid value", func() {
+			data, err := surge.ToBinary(Signer{Key: CompressedKey{0x04, 0x01, 0x02}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(surge.FromBinary(&Signer{}, data)).To(Equal(surge.ErrValidation{Path: "Key", Err: fmt.Errorf("bad prefix")}))
+		})
+	})
+
+	Context("when unmarshaling nested values", func() {
+		It("should validate from the bottom up", func() {
+			validationOrder = nil
+			Expect(surge.FromBinary(&OrderedParent{}, []byte{})).To(Succeed())
+			Expect(validationOrder).To(Equal([]string{"child", "parent"}))
+		})
+	})
+})
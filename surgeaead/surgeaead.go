@@ -0,0 +1,104 @@
+// Package surgeaead seals surge encodings in an authenticated encryption
+// envelope. Envelopes are authenticated before any of their bytes are passed to
+// the surge decoder, so unauthenticated (and potentially malicious) input never
+// reaches an Unmarshaler.
+package surgeaead
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/renproject/surge"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ErrAuthenticationFailed is returned when an envelope cannot be
+// authenticated. This happens when the key, or associated data, is wrong, or
+// when the envelope has been tampered with.
+var ErrAuthenticationFailed = errors.New("message authentication failed")
+
+// NewAESGCM returns an AES-GCM AEAD using the given key. The key must be 16,
+// 24, or 32 bytes long to select AES-128, AES-192, or AES-256 respectively.
+func NewAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewChaCha20Poly1305 returns a ChaCha20-Poly1305 AEAD using the given key. The
+// key must be 32 bytes long.
+func NewChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	return chacha20poly1305.New(key)
+}
+
+// Seal a value into an envelope. The value is marshaled using surge, and the
+// resulting bytes are encrypted and authenticated (along with the associated
+// data) using a randomly generated nonce. The envelope is the nonce followed by
+// the ciphertext. The associated data is authenticated, but it is not included
+// in the envelope, so the same associated data must be given when opening the
+// envelope.
+//
+//  aead, err := surgeaead.NewChaCha20Poly1305(key)
+//  if err != nil {
+//      panic(err)
+//  }
+//  envelope, err := surgeaead.Seal(aead, share, []byte("share"))
+//  if err != nil {
+//      panic(err)
+//  }
+//
+func Seal(aead cipher.AEAD, v interface{}, ad []byte) ([]byte, error) {
+	plaintext, err := surge.ToBinary(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal: %v", err)
+	}
+	defer zero(plaintext)
+
+	nonceSize := aead.NonceSize()
+	envelope := make([]byte, nonceSize, nonceSize+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(envelope); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %v", err)
+	}
+	return aead.Seal(envelope, envelope, plaintext, ad), nil
+}
+
+// Open an envelope into a pointer to a value. The envelope is authenticated
+// (along with the associated data) and decrypted, and only then are the
+// resulting bytes unmarshaled using surge. If authentication fails, then
+// ErrAuthenticationFailed is returned and the value is left untouched.
+//
+//  share := Share{}
+//  if err := surgeaead.Open(aead, &share, envelope, []byte("share")); err != nil {
+//      panic(err)
+//  }
+//
+func Open(aead cipher.AEAD, v interface{}, envelope, ad []byte) error {
+	nonceSize := aead.NonceSize()
+	if len(envelope) < nonceSize+aead.Overhead() {
+		return surge.ErrUnexpectedEndOfBuffer
+	}
+	if len(envelope)-nonceSize-aead.Overhead() > surge.MaxBytes {
+		return surge.ErrLengthOverflow
+	}
+	nonce, ciphertext := envelope[:nonceSize], envelope[nonceSize:]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return ErrAuthenticationFailed
+	}
+	defer zero(plaintext)
+
+	return surge.FromBinary(v, plaintext)
+}
+
+// zero the plaintext so that secrets do not linger in memory longer than
+// necessary.
+func zero(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
@@ -0,0 +1,13 @@
+package surgeaead_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSurgeaead(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Surgeaead Suite")
+}
@@ -0,0 +1,126 @@
+package surgeaead_test
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeaead"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type Share struct {
+	Index uint64
+	Value []byte
+	Owner string
+}
+
+var _ = Describe("Envelope", func() {
+
+	newKey := func(n int) []byte {
+		key := make([]byte, n)
+		_, err := rand.Read(key)
+		Expect(err).ToNot(HaveOccurred())
+		return key
+	}
+
+	aeads := map[string]func() cipher.AEAD{
+		"AES-GCM": func() cipher.AEAD {
+			aead, err := surgeaead.NewAESGCM(newKey(32))
+			Expect(err).ToNot(HaveOccurred())
+			return aead
+		},
+		"ChaCha20-Poly1305": func() cipher.AEAD {
+			aead, err := surgeaead.NewChaCha20Poly1305(newKey(32))
+			Expect(err).ToNot(HaveOccurred())
+			return aead
+		},
+	}
+
+	share := Share{Index: 42, Value: []byte{1, 2, 3, 4}, Owner: "alice"}
+
+	for name, newAEAD := range aeads {
+		name, newAEAD := name, newAEAD
+
+		Context(name, func() {
+			Context("when sealing and then opening", func() {
+				It("should return itself", func() {
+					aead := newAEAD()
+					envelope, err := surgeaead.Seal(aead, share, []byte("ad"))
+					Expect(err).ToNot(HaveOccurred())
+
+					opened := Share{}
+					Expect(surgeaead.Open(aead, &opened, envelope, []byte("ad"))).To(Succeed())
+					Expect(opened).To(Equal(share))
+				})
+
+				It("should not contain the plaintext", func() {
+					envelope, err := surgeaead.Seal(newAEAD(), share, nil)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(string(envelope)).ToNot(ContainSubstring(share.Owner))
+				})
+			})
+
+			Context("when the associated data is wrong", func() {
+				It("should return an authentication error", func() {
+					aead := newAEAD()
+					envelope, err := surgeaead.Seal(aead, share, []byte("ad"))
+					Expect(err).ToNot(HaveOccurred())
+
+					opened := Share{}
+					Expect(surgeaead.Open(aead, &opened, envelope, []byte("da"))).To(Equal(surgeaead.ErrAuthenticationFailed))
+					Expect(opened).To(Equal(Share{}))
+				})
+			})
+
+			Context("when the key is wrong", func() {
+				It("should return an authentication error", func() {
+					envelope, err := surgeaead.Seal(newAEAD(), share, nil)
+					Expect(err).ToNot(HaveOccurred())
+
+					opened := Share{}
+					Expect(surgeaead.Open(newAEAD(), &opened, envelope, nil)).To(Equal(surgeaead.ErrAuthenticationFailed))
+				})
+			})
+
+			Context("when the envelope has been tampered with", func() {
+				It("should return an authentication error for every flipped bit", func() {
+					aead := newAEAD()
+					envelope, err := surgeaead.Seal(aead, share, nil)
+					Expect(err).ToNot(HaveOccurred())
+
+					for i := range envelope {
+						tampered := append([]byte{}, envelope...)
+						tampered[i] ^= 0x01
+						opened := Share{}
+						Expect(surgeaead.Open(aead, &opened, tampered, nil)).To(Equal(surgeaead.ErrAuthenticationFailed))
+					}
+				})
+			})
+
+			Context("when the envelope is too short", func() {
+				It("should return an error", func() {
+					aead := newAEAD()
+					envelope, err := surgeaead.Seal(aead, share, nil)
+					Expect(err).ToNot(HaveOccurred())
+
+					for n := 0; n < aead.NonceSize()+aead.Overhead(); n++ {
+						opened := Share{}
+						Expect(surgeaead.Open(aead, &opened, envelope[:n], nil)).To(Equal(surge.ErrUnexpectedEndOfBuffer))
+					}
+				})
+			})
+		})
+	}
+
+	Context("when the key has the wrong length", func() {
+		It("should return an error", func() {
+			_, err := surgeaead.NewAESGCM(newKey(7))
+			Expect(err).To(HaveOccurred())
+			_, err = surgeaead.NewChaCha20Poly1305(newKey(16))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
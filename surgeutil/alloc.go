@@ -0,0 +1,147 @@
+package surgeutil
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/renproject/surge"
+)
+
+// DefaultAllocFactor is the maximum number of bytes that unmarshaling is
+// allowed to allocate, per byte of memory quota, when the options do not say
+// otherwise.
+const DefaultAllocFactor = 4
+
+// AllocSlack is the number of bytes that unmarshaling is allowed to allocate
+// on top of those allowed by the allocation factor. It covers small allocations
+// that are not charged against the memory quota, such as errors.
+const AllocSlack = 1024
+
+// AllocCheck generates a random instance of a type, marshals it into binary,
+// and then measures the number of bytes allocated while unmarshaling the
+// result. An error is returned when unmarshaling allocates more than
+// DefaultAllocFactor bytes per byte of memory quota consumed. Adversarial
+// variants of the binary representation, with every length prefix inflated to
+// near the memory quota, are also unmarshaled with a memory quota of
+// FuzzMaxBytes, and an error is returned when they allocate more than
+// DefaultAllocFactor bytes per byte of that memory quota. Otherwise, it returns
+// nil.
+//
+// The memory quota is the only thing that protects against malicious inputs,
+// so it must account for (almost) everything that is allocated.
+func AllocCheck(t reflect.Type) error {
+	return AllocCheckWithOptions(t, Options{})
+}
+
+// AllocCheckWithOptions is the same as AllocCheck, but uses the given options.
+// When the check fails, an ErrCheckFailed is returned for the smallest value
+// that fails.
+func AllocCheckWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, allocation)
+}
+
+func allocation(x reflect.Value, opts Options) error {
+	factor := allocFactor(opts)
+	data, err := surge.ToBinary(x.Interface())
+	if err != nil {
+		return fmt.Errorf("cannot marshal: %w", err)
+	}
+
+	// Generated input
+	var rem int
+	var unmarshalErr error
+	unmarshal := func() {
+		_, rem, unmarshalErr = surge.Unmarshal(reflect.New(x.Type()).Interface(), data, surge.MaxBytes)
+	}
+	allocated := AllocatedBytes(unmarshal)
+	if unmarshalErr != nil {
+		return fmt.Errorf("cannot unmarshal: %w", unmarshalErr)
+	}
+	consumed := surge.MaxBytes - rem
+	if allocated > factor*uint64(consumed)+AllocSlack {
+		return fmt.Errorf("allocated %v bytes in %v allocations, but only consumed %v bytes of memory quota", allocated, testing.AllocsPerRun(1, unmarshal), consumed)
+	}
+
+	// Adversarial inputs
+	lay := layout{}
+	if _, err := lay.walk(x.Type(), data, 0); err != nil {
+		return fmt.Errorf("cannot walk binary representation: %w", err)
+	}
+	r := rand.New(rand.NewSource(int64(len(data))))
+	for _, prefix := range lay.prefixes {
+		for _, n := range inflatedLengths(byteOrder.Uint32(data[prefix:]), r) {
+			mutated := append([]byte{}, data...)
+			byteOrder.PutUint32(mutated[prefix:], n)
+			if err := allocationWithQuota(x.Type(), mutated, factor); err != nil {
+				return fmt.Errorf("inflated length prefix at offset %v to %v: %w", prefix, n, err)
+			}
+		}
+	}
+	return nil
+}
+
+// allocationWithQuota unmarshals bytes with a memory quota of FuzzMaxBytes,
+// and returns an error when more than the given number of bytes are allocated
+// per byte of memory quota.
+func allocationWithQuota(t reflect.Type, data []byte, factor uint64) error {
+	unmarshal := func() {
+		_, _, _ = surge.Unmarshal(reflect.New(t).Interface(), data, FuzzMaxBytes)
+	}
+	if allocated := AllocatedBytes(unmarshal); allocated > factor*FuzzMaxBytes+AllocSlack {
+		return fmt.Errorf("allocated %v bytes in %v allocations with a memory quota of %v bytes", allocated, testing.AllocsPerRun(1, unmarshal), FuzzMaxBytes)
+	}
+	return nil
+}
+
+// inflatedLengths returns lengths that a length prefix can be inflated to, in
+// order to make unmarshaling allocate as much memory as possible.
+func inflatedLengths(n uint32, r *rand.Rand) []uint32 {
+	return []uint32{
+		n + 1,
+		uint32(FuzzMaxBytes - r.Intn(64)),
+		uint32(surge.MaxBytes - r.Intn(64)),
+		uint32(FuzzMaxBytes / (1 + r.Intn(64))),
+		0xFFFFFFFF,
+	}
+}
+
+func allocFactor(opts Options) uint64 {
+	if opts.AllocFactor == 0 {
+		return DefaultAllocFactor
+	}
+	return uint64(opts.AllocFactor)
+}
+
+// AllocationRuns is the number of times that AllocatedBytes runs a function.
+const AllocationRuns = 3
+
+// AllocatedBytes returns the number of bytes allocated by a function. The
+// allocations of the whole process are measured, so the function is run
+// AllocationRuns times with GOMAXPROCS set to 1 (like testing.AllocsPerRun),
+// and the fewest bytes allocated by any run is returned. This makes it
+// unlikely that allocations made by other goroutines are counted. The function
+// must allocate the same number of bytes every time that it is run.
+//
+//  allocated := surgeutil.AllocatedBytes(func() {
+//      surge.Unmarshal(&x, data, quota)
+//  })
+//
+func AllocatedBytes(f func()) uint64 {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	var before, after runtime.MemStats
+	min := uint64(math.MaxUint64)
+	for i := 0; i < AllocationRuns; i++ {
+		runtime.ReadMemStats(&before)
+		f()
+		runtime.ReadMemStats(&after)
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated < min {
+			min = allocated
+		}
+	}
+	return min
+}
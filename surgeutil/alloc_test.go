@@ -0,0 +1,69 @@
+package surgeutil_test
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Wasteful is a custom implementation that allocates a scratch buffer, much
+// larger than its value, without charging it against the memory quota.
+type Wasteful []byte
+
+func (w Wasteful) SizeHint() int {
+	return surge.SizeHintBytes([]byte(w))
+}
+
+func (w Wasteful) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalBytes([]byte(w), buf, rem)
+}
+
+func (w *Wasteful) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	scratch := make([]byte, 64*len(buf))
+	buf, rem, err := surge.UnmarshalBytes((*[]byte)(w), buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	copy(scratch, *w)
+	return buf, rem, nil
+}
+
+var _ = Describe("AllocCheck", func() {
+	Context("when unmarshaling allocates no more than the memory quota", func() {
+		It("should succeed", func() {
+			for _, t := range []reflect.Type{
+				reflect.TypeOf(Record{}),
+				reflect.TypeOf(Tagged{}),
+				reflect.TypeOf(map[string][]uint16{}),
+				reflect.TypeOf(map[uint8]map[string]bool{}),
+				reflect.TypeOf([][]byte{}),
+				reflect.TypeOf([]Forgetful{}),
+			} {
+				for trial := 0; trial < 10; trial++ {
+					Expect(surgeutil.AllocCheck(t)).To(Succeed())
+				}
+			}
+		})
+	})
+
+	Context("when unmarshaling allocates more than the memory quota", func() {
+		It("should return an error", func() {
+			t := reflect.TypeOf(Wasteful{})
+			err := surgeutil.AllocCheckWithOptions(t, surgeutil.Options{Seed: 1})
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Error()).To(ContainSubstring("allocated"))
+			Expect(f.Error()).To(ContainSubstring("memory quota"))
+		})
+
+		It("should succeed when the allocation factor is large enough", func() {
+			t := reflect.TypeOf(Wasteful{})
+			Expect(surgeutil.AllocCheckWithOptions(t, surgeutil.Options{Seed: 1, AllocFactor: 128})).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,211 @@
+package surgeutil
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/renproject/surge"
+)
+
+// DefaultBenchmarkSeed is the seed used to generate the values that are
+// benchmarked, unless the options say otherwise. A fixed seed means that the
+// same value is benchmarked every time, so results can be compared between
+// runs.
+const DefaultBenchmarkSeed = 1
+
+// BenchmarkMarshal generates a random instance of a type, and then benchmarks
+// marshaling it into binary. As well as ns/op, it reports B/op, allocs/op, and
+// the number of bytes in the binary representation as bytes/op.
+//
+//  func BenchmarkMyStructMarshal(b *testing.B) {
+//      surgeutil.BenchmarkMarshal(b, reflect.TypeOf(MyStruct{}))
+//  }
+//
+func BenchmarkMarshal(b *testing.B, t reflect.Type) {
+	b.Helper()
+	BenchmarkMarshalWithOptions(b, t, Options{})
+}
+
+// BenchmarkMarshalWithOptions is the same as BenchmarkMarshal, but uses the
+// given options. The seed is given by the Seed option (or
+// DefaultBenchmarkSeed). When the Compare option is set, marshaling with surge,
+// encoding/json, and encoding/gob are run as the "surge", "json", and "gob"
+// sub-benchmarks.
+func BenchmarkMarshalWithOptions(b *testing.B, t reflect.Type, opts Options) {
+	b.Helper()
+	v := benchmarkValue(b, t, opts).Interface()
+	benchmark(b, opts, "surge", func(b *testing.B) {
+		buf := make([]byte, surge.SizeHint(v))
+		tail := buf
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var err error
+			if tail, _, err = surge.Marshal(v, buf, surge.MaxBytes); err != nil {
+				b.Fatalf("cannot marshal: %v", err)
+			}
+		}
+		// The size hint can over-estimate, so the number of bytes written is
+		// reported instead.
+		b.ReportMetric(float64(len(buf)-len(tail)), "bytes/op")
+	})
+	if !opts.Compare {
+		return
+	}
+	b.Run("json", func(b *testing.B) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			b.Skipf("cannot marshal json: %v", err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(v); err != nil {
+				b.Fatalf("cannot marshal json: %v", err)
+			}
+		}
+		b.ReportMetric(float64(len(data)), "bytes/op")
+	})
+	b.Run("gob", func(b *testing.B) {
+		data, err := gobMarshal(v)
+		if err != nil {
+			b.Skipf("cannot marshal gob: %v", err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := gobMarshal(v); err != nil {
+				b.Fatalf("cannot marshal gob: %v", err)
+			}
+		}
+		b.ReportMetric(float64(len(data)), "bytes/op")
+	})
+}
+
+// BenchmarkUnmarshal generates a random instance of a type, marshals it into
+// binary, and then benchmarks unmarshaling the result into a new instance of
+// the type. As well as ns/op, it reports B/op, allocs/op, and the number of
+// bytes in the binary representation as bytes/op.
+func BenchmarkUnmarshal(b *testing.B, t reflect.Type) {
+	b.Helper()
+	BenchmarkUnmarshalWithOptions(b, t, Options{})
+}
+
+// BenchmarkUnmarshalWithOptions is the same as BenchmarkUnmarshal, but uses the
+// given options. The seed is given by the Seed option (or
+// DefaultBenchmarkSeed). When the Compare option is set, unmarshaling with
+// surge, encoding/json, and encoding/gob are run as the "surge", "json", and
+// "gob" sub-benchmarks.
+func BenchmarkUnmarshalWithOptions(b *testing.B, t reflect.Type, opts Options) {
+	b.Helper()
+	v := benchmarkValue(b, t, opts).Interface()
+	benchmark(b, opts, "surge", func(b *testing.B) {
+		data, err := surge.ToBinary(v)
+		if err != nil {
+			b.Fatalf("cannot marshal: %v", err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := surge.Unmarshal(reflect.New(t).Interface(), data, surge.MaxBytes); err != nil {
+				b.Fatalf("cannot unmarshal: %v", err)
+			}
+		}
+		b.ReportMetric(float64(len(data)), "bytes/op")
+	})
+	if !opts.Compare {
+		return
+	}
+	b.Run("json", func(b *testing.B) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			b.Skipf("cannot marshal json: %v", err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := json.Unmarshal(data, reflect.New(t).Interface()); err != nil {
+				b.Fatalf("cannot unmarshal json: %v", err)
+			}
+		}
+		b.ReportMetric(float64(len(data)), "bytes/op")
+	})
+	b.Run("gob", func(b *testing.B) {
+		data, err := gobMarshal(v)
+		if err != nil {
+			b.Skipf("cannot marshal gob: %v", err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := gob.NewDecoder(bytes.NewReader(data)).Decode(reflect.New(t).Interface()); err != nil {
+				b.Fatalf("cannot unmarshal gob: %v", err)
+			}
+		}
+		b.ReportMetric(float64(len(data)), "bytes/op")
+	})
+}
+
+// BenchmarkSizeHint generates a random instance of a type, and then benchmarks
+// computing its size hint. As well as ns/op, it reports B/op, allocs/op, and
+// the size hint as bytes/op.
+func BenchmarkSizeHint(b *testing.B, t reflect.Type) {
+	b.Helper()
+	BenchmarkSizeHintWithOptions(b, t, Options{})
+}
+
+// BenchmarkSizeHintWithOptions is the same as BenchmarkSizeHint, but uses the
+// given options. The seed is given by the Seed option (or
+// DefaultBenchmarkSeed). The Compare option is ignored, because neither
+// encoding/json nor encoding/gob have size hints.
+func BenchmarkSizeHintWithOptions(b *testing.B, t reflect.Type, opts Options) {
+	b.Helper()
+	v := benchmarkValue(b, t, opts).Interface()
+	sizeHint := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sizeHint = surge.SizeHint(v)
+	}
+	b.ReportMetric(float64(sizeHint), "bytes/op")
+}
+
+// benchmarkValue generates the random value that is benchmarked. The testing
+// package calls benchmarks several times (with increasing values of b.N), so
+// the seed must be fixed for the same value to be generated every time.
+func benchmarkValue(b *testing.B, t reflect.Type, opts Options) reflect.Value {
+	b.Helper()
+	if opts.Seed == 0 {
+		opts.Seed = DefaultBenchmarkSeed
+	}
+	x, err := Generate(t, rand.New(rand.NewSource(opts.Seed)), opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return x
+}
+
+// benchmark runs f as a sub-benchmark with the given name when comparing
+// against other encodings. Otherwise, it runs f directly.
+func benchmark(b *testing.B, opts Options, name string, f func(b *testing.B)) {
+	b.Helper()
+	if opts.Compare {
+		b.Run(name, f)
+		return
+	}
+	f(b)
+}
+
+// gobMarshal a value into a new gob stream. Every stream starts with the type
+// of the value, so this is included in the number of bytes.
+func gobMarshal(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,68 @@
+package surgeutil_test
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func BenchmarkRecordMarshal(b *testing.B) {
+	surgeutil.BenchmarkMarshalWithOptions(b, reflect.TypeOf(Record{}), surgeutil.Options{Compare: true})
+}
+
+func BenchmarkRecordUnmarshal(b *testing.B) {
+	surgeutil.BenchmarkUnmarshalWithOptions(b, reflect.TypeOf(Record{}), surgeutil.Options{Compare: true})
+}
+
+func BenchmarkRecordSizeHint(b *testing.B) {
+	surgeutil.BenchmarkSizeHint(b, reflect.TypeOf(Record{}))
+}
+
+var _ = Describe("Benchmarks", func() {
+	t := reflect.TypeOf(Record{})
+
+	// Each benchmark runs for about a second, so they are skipped by
+	// go test -short. The Benchmark functions above measure performance.
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("benchmarks are not run in short mode")
+		}
+	})
+
+	sizeHint := func() float64 {
+		x, err := surgeutil.Generate(t, rand.New(rand.NewSource(surgeutil.DefaultBenchmarkSeed)), surgeutil.Options{})
+		Expect(err).ToNot(HaveOccurred())
+		return float64(surge.SizeHint(x.Interface()))
+	}
+
+	for _, benchmark := range []struct {
+		name string
+		f    func(b *testing.B, t reflect.Type)
+	}{
+		{"BenchmarkMarshal", surgeutil.BenchmarkMarshal},
+		{"BenchmarkUnmarshal", surgeutil.BenchmarkUnmarshal},
+		{"BenchmarkSizeHint", surgeutil.BenchmarkSizeHint},
+	} {
+		benchmark := benchmark
+		Context(benchmark.name, func() {
+			It("should report the number of bytes in the binary representation", func() {
+				result := testing.Benchmark(func(b *testing.B) { benchmark.f(b, t) })
+				Expect(result.N).To(BeNumerically(">", 0))
+				Expect(result.Extra).To(HaveKeyWithValue("bytes/op", sizeHint()))
+			})
+		})
+	}
+
+	Context("when the size hint over-estimates", func() {
+		It("should report the number of bytes that were written", func() {
+			result := testing.Benchmark(func(b *testing.B) { surgeutil.BenchmarkMarshal(b, reflect.TypeOf(Overestimated(0))) })
+			Expect(result.Extra).To(HaveKeyWithValue("bytes/op", float64(surge.SizeHintU64)))
+		})
+	})
+})
@@ -0,0 +1,167 @@
+package surgeutil
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultIterations is the number of random values that CheckAll checks, for
+// each check, unless the options say otherwise.
+const DefaultIterations = 10
+
+// checks that are run by CheckAll, in order.
+var checks = []struct {
+	name  string
+	check func(t reflect.Type, opts Options) error
+}{
+	{"MarshalUnmarshal", MarshalUnmarshalCheckWithOptions},
+	{"Fuzz", FuzzWithOptions},
+	{"MarshalBufTooSmall", MarshalBufTooSmallWithOptions},
+	{"MarshalRemTooSmall", MarshalRemTooSmallWithOptions},
+	{"UnmarshalBufTooSmall", UnmarshalBufTooSmallWithOptions},
+	{"UnmarshalRemTooSmall", UnmarshalRemTooSmallWithOptions},
+	{"Determinism", DeterminismCheckWithOptions},
+	{"SizeHint", SizeHintCheckWithOptions},
+}
+
+// CheckAll runs the MarshalUnmarshal, Fuzz, MarshalBufTooSmall,
+// MarshalRemTooSmall, UnmarshalBufTooSmall, UnmarshalRemTooSmall, Determinism,
+// and SizeHint checks against a type, each as its own subtest (when t is a
+// *testing.T), and reports failures using t. Each check is run for the number
+// of random values given by the Iterations option. The first value is
+// generated from the seed, and the seed is incremented (skipping zero) for
+// each value after that, so failures report a seed that replays exactly the
+// value that failed. Warnings are reported using the Logf option, or using
+// t.Logf when it is nil.
+//
+//  func TestMyStruct(t *testing.T) {
+//      surgeutil.CheckAll(t, reflect.TypeOf(MyStruct{}), surgeutil.Options{})
+//  }
+func CheckAll(t testing.TB, typ reflect.Type, opts Options) {
+	t.Helper()
+	checkAll(t, typ, opts)
+}
+
+// CheckAllTypes runs CheckAll against every type, each as its own subtest
+// (when t is a *testing.T), and then logs a summary of the checks that passed
+// and failed for every type.
+func CheckAllTypes(t testing.TB, types []reflect.Type, opts Options) {
+	t.Helper()
+	summaries := make([]summary, 0, len(types))
+	for _, typ := range types {
+		typ := typ
+		run(t, typ.String(), func(t testing.TB) {
+			t.Helper()
+			summaries = append(summaries, checkAll(t, typ, opts))
+		})
+	}
+	t.Logf("%v", formatSummaries(summaries))
+}
+
+// summary of the checks that were run against a type.
+type summary struct {
+	t        reflect.Type
+	passed   int
+	failed   []string
+	duration time.Duration
+}
+
+func checkAll(t testing.TB, typ reflect.Type, opts Options) summary {
+	t.Helper()
+	s := summary{t: typ}
+	start := time.Now()
+
+	seed, err := resolveSeed(opts)
+	if err != nil {
+		t.Errorf("%v", err)
+		s.failed = append(s.failed, "Seed")
+		return s
+	}
+	iterations := opts.Iterations
+	if iterations == 0 {
+		iterations = DefaultIterations
+	}
+	if opts.Logf == nil {
+		opts.Logf = t.Logf
+	}
+
+	for _, c := range checks {
+		c := c
+		passed := true
+		run(t, c.name, func(t testing.TB) {
+			t.Helper()
+			for i := 0; i < iterations; i++ {
+				opts := opts
+				opts.Seed = iterationSeed(seed, i)
+				if err := runCheck(c.check, typ, opts); err != nil {
+					t.Errorf("%v check failed for %v: %v", c.name, typ, err)
+					passed = false
+					return
+				}
+			}
+		})
+		if passed {
+			s.passed++
+		} else {
+			s.failed = append(s.failed, c.name)
+		}
+	}
+	s.duration = time.Since(start)
+	return s
+}
+
+// iterationSeed returns the seed used for the ith value checked by CheckAll.
+// Seeds are incremented for each value, skipping zero (which would mean that
+// the seed is not set, and that the value could not be replayed).
+func iterationSeed(seed int64, i int) int64 {
+	if seed < 0 && seed+int64(i) >= 0 {
+		return seed + int64(i) + 1
+	}
+	return seed + int64(i)
+}
+
+// runCheck runs a check, recovering from panics so that they are reported as
+// failures of the check.
+func runCheck(check func(t reflect.Type, opts Options) error, t reflect.Type, opts Options) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = NewErrCheckFailed(opts.Seed, nil, nil, fmt.Errorf("panicked: %v", p))
+		}
+	}()
+	return check(t, opts)
+}
+
+// run a function as a subtest when t is a *testing.T. Otherwise, the function
+// is called directly.
+func run(t testing.TB, name string, f func(t testing.TB)) {
+	t.Helper()
+	switch t := t.(type) {
+	case *testing.T:
+		t.Run(name, func(t *testing.T) {
+			t.Helper()
+			f(t)
+		})
+	default:
+		f(t)
+	}
+}
+
+func formatSummaries(summaries []summary) string {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "surgeutil summary:\n")
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "TYPE\tPASSED\tFAILED\tDURATION\t\n")
+	for _, s := range summaries {
+		failed := "-"
+		if len(s.failed) > 0 {
+			failed = strings.Join(s.failed, ", ")
+		}
+		fmt.Fprintf(w, "%v\t%v/%v\t%v\t%v\t\n", s.t, s.passed, s.passed+len(s.failed), failed, s.duration.Round(time.Millisecond))
+	}
+	w.Flush()
+	return b.String()
+}
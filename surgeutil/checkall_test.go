@@ -0,0 +1,112 @@
+package surgeutil_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recorder is a testing.TB that records errors and logs, instead of reporting
+// them.
+type recorder struct {
+	testing.TB
+	errors []string
+	logs   []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Logf(format string, args ...interface{}) {
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+type Seeded uint64
+
+func TestCheckAll(t *testing.T) {
+	surgeutil.CheckAll(t, reflect.TypeOf(Record{}), surgeutil.Options{Steps: 10})
+}
+
+func TestCheckAllTypes(t *testing.T) {
+	surgeutil.CheckAllTypes(t, []reflect.Type{
+		reflect.TypeOf(Record{}),
+		reflect.TypeOf(map[string][]uint16{}),
+	}, surgeutil.Options{Steps: 10, Iterations: 3})
+}
+
+var _ = Describe("CheckAll", func() {
+	Context("when a type is well-behaved", func() {
+		It("should not report errors", func() {
+			r := &recorder{}
+			surgeutil.CheckAll(r, reflect.TypeOf(Record{}), surgeutil.Options{Steps: 10, Iterations: 3})
+			Expect(r.errors).To(BeEmpty())
+		})
+	})
+
+	Context("when a type fails some checks", func() {
+		It("should report an error for each check that fails", func() {
+			r := &recorder{}
+			surgeutil.CheckAll(r, reflect.TypeOf([]Forgetful{}), surgeutil.Options{Seed: 1, Steps: 10, Iterations: 3})
+			Expect(r.errors).To(HaveLen(2))
+			Expect(r.errors[0]).To(ContainSubstring("MarshalUnmarshal check failed"))
+			Expect(r.errors[0]).To(ContainSubstring("SURGEUTIL_SEED="))
+			Expect(r.errors[1]).To(ContainSubstring("Determinism check failed"))
+		})
+
+		It("should report warnings using the testing.TB", func() {
+			r := &recorder{}
+			surgeutil.CheckAll(r, reflect.TypeOf(Overestimated(0)), surgeutil.Options{Iterations: 1})
+			Expect(r.logs).To(ContainElement(ContainSubstring("over-estimates")))
+		})
+	})
+
+	Context("when the seeds of the values cross zero", func() {
+		It("should skip zero, so that every value can be replayed", func() {
+			t := reflect.TypeOf(Seeded(0))
+			generated := map[Seeded]bool{}
+			surgeutil.RegisterGenerator(t, func(r *rand.Rand, size int) reflect.Value {
+				x := Seeded(r.Int63())
+				generated[x] = true
+				return reflect.ValueOf(x)
+			})
+			defer surgeutil.RegisterGenerator(t, nil)
+
+			r := &recorder{}
+			surgeutil.CheckAll(r, t, surgeutil.Options{Seed: -2, Steps: 10, Iterations: 3})
+			Expect(r.errors).To(BeEmpty())
+
+			expected := map[Seeded]bool{}
+			for _, seed := range []int64{-2, -1, 1} {
+				expected[Seeded(rand.New(rand.NewSource(seed)).Int63())] = true
+			}
+			Expect(generated).To(Equal(expected))
+		})
+	})
+
+	Context("when checking a table of types", func() {
+		It("should log a summary", func() {
+			r := &recorder{}
+			surgeutil.CheckAllTypes(r, []reflect.Type{
+				reflect.TypeOf(Record{}),
+				reflect.TypeOf([]Forgetful{}),
+				reflect.TypeOf(Underestimated(0)),
+			}, surgeutil.Options{Seed: 1, Steps: 10, Iterations: 3})
+			Expect(r.logs).ToNot(BeEmpty())
+			summary := r.logs[len(r.logs)-1]
+			Expect(summary).To(ContainSubstring("surgeutil summary"))
+			Expect(summary).To(MatchRegexp(`surgeutil_test.Record\s+8/8\s+-`))
+			Expect(summary).To(MatchRegexp(`\[\]surgeutil_test.Forgetful\s+6/8\s+MarshalUnmarshal, Determinism\s`))
+			Expect(summary).To(MatchRegexp(`surgeutil_test.Underestimated\s+\d/8\s+.*SizeHint`))
+			Expect(r.errors).To(ContainElement(ContainSubstring("panicked")))
+		})
+	})
+})
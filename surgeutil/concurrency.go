@@ -0,0 +1,105 @@
+package surgeutil
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/renproject/surge"
+)
+
+// DefaultGoroutines is the number of goroutines that marshal a value
+// simultaneously in ConcurrencyCheck, unless the options say otherwise.
+const DefaultGoroutines = 8
+
+// ConcurrencyCheck generates a random instance of a type, and then size hints
+// and marshals it from many goroutines simultaneously. An error is returned
+// when any of the size hints, or binary representations, are different, or
+// when marshaling panics or returns an error. Otherwise, it returns nil.
+//
+// Values are often marshaled from many goroutines at once (for example, when
+// broadcasting a message to many peers), and custom implementations that
+// lazily cache state can be unsafe when they are. Differences in the output
+// catch some of these bugs, but data races are best caught by running the
+// check with the race detector enabled:
+//
+//  go test -race ./...
+//
+func ConcurrencyCheck(t reflect.Type) error {
+	return ConcurrencyCheckWithOptions(t, Options{})
+}
+
+// ConcurrencyCheckWithOptions is the same as ConcurrencyCheck, but uses the
+// given options. The number of goroutines is given by the Goroutines option,
+// and the number of times that each goroutine marshals the value is given by
+// the Repeats option. When the check fails, an ErrCheckFailed is returned for
+// the smallest value that fails.
+func ConcurrencyCheckWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, concurrency)
+}
+
+// output of size hinting and marshaling a value once.
+type output struct {
+	sizeHint int
+	data     []byte
+	err      error
+}
+
+func concurrency(x reflect.Value, opts Options) error {
+	goroutines := opts.Goroutines
+	if goroutines == 0 {
+		goroutines = DefaultGoroutines
+	}
+	repeats := opts.Repeats
+	if repeats == 0 {
+		repeats = DefaultRepeats
+	}
+
+	v := x.Interface()
+	outputs := make([][]output, goroutines)
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for g := range outputs {
+		outputs[g] = make([]output, repeats)
+		wg.Add(1)
+		go func(outputs []output) {
+			defer wg.Done()
+			// Wait until every goroutine has started, so that they marshal
+			// the value at the same time.
+			<-start
+			for i := range outputs {
+				outputs[i] = sizeHintAndMarshal(v)
+			}
+		}(outputs[g])
+	}
+	close(start)
+	wg.Wait()
+
+	expected := outputs[0][0]
+	for g := range outputs {
+		for i, actual := range outputs[g] {
+			if actual.err != nil {
+				return fmt.Errorf("goroutine %v, marshal %v: %v", g, i, actual.err)
+			}
+			if actual.sizeHint != expected.sizeHint {
+				return fmt.Errorf("goroutine %v, size hint %v: expected %v, got %v", g, i, expected.sizeHint, actual.sizeHint)
+			}
+			if offset := FirstDifference(expected.data, actual.data); offset >= 0 {
+				return fmt.Errorf("goroutine %v, marshal %v differs at offset %v: %x != %x", g, i, offset, actual.data, expected.data)
+			}
+		}
+	}
+	return nil
+}
+
+// sizeHintAndMarshal a value, and recover from panics.
+func sizeHintAndMarshal(v interface{}) (out output) {
+	defer func() {
+		if p := recover(); p != nil {
+			out.err = fmt.Errorf("panicked: %v", p)
+		}
+	}()
+	out.sizeHint = surge.SizeHint(v)
+	out.data, out.err = surge.ToBinary(v)
+	return out
+}
@@ -0,0 +1,89 @@
+package surgeutil_test
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"sync"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Cached is a custom implementation that lazily caches its binary
+// representation, the first time that it is marshaled.
+type Cached struct {
+	Values []uint16
+	cache  *cache
+}
+
+type cache struct {
+	once sync.Once
+	data []byte
+}
+
+func (c Cached) Generate(r *rand.Rand, size int) reflect.Value {
+	values := make([]uint16, r.Intn(size+1))
+	for i := range values {
+		values[i] = uint16(r.Int())
+	}
+	return reflect.ValueOf(Cached{Values: values, cache: new(cache)})
+}
+
+func (c Cached) SizeHint() int {
+	return surge.SizeHint(c.Values)
+}
+
+func (c Cached) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	c.cache.once.Do(func() {
+		c.cache.data, _ = surge.ToBinary(c.Values)
+	})
+	if len(buf) < len(c.cache.data) || rem < len(c.cache.data) {
+		return buf, rem, surge.ErrUnexpectedEndOfBuffer
+	}
+	copy(buf, c.cache.data)
+	return buf[len(c.cache.data):], rem - len(c.cache.data), nil
+}
+
+func (c *Cached) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	c.cache = new(cache)
+	return surge.Unmarshal(&c.Values, buf, rem)
+}
+
+var _ = Describe("ConcurrencyCheck", func() {
+	Context("when marshaling is safe for concurrent use", func() {
+		It("should succeed", func() {
+			for _, t := range []reflect.Type{
+				reflect.TypeOf(Record{}),
+				reflect.TypeOf(map[string][]uint16{}),
+				reflect.TypeOf([]Point{}),
+				reflect.TypeOf(Cached{}),
+			} {
+				for trial := 0; trial < 10; trial++ {
+					Expect(surgeutil.ConcurrencyCheck(t)).To(Succeed())
+				}
+			}
+		})
+	})
+
+	Context("when marshaling is different in each goroutine", func() {
+		It("should return an error with the first differing offset", func() {
+			err := surgeutil.ConcurrencyCheckWithOptions(reflect.TypeOf(StampedRecord{}), surgeutil.Options{Seed: 1, Goroutines: 4, Repeats: 2})
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Error()).To(ContainSubstring("differs at offset 11"))
+		})
+	})
+
+	Context("when marshaling panics", func() {
+		It("should return an error", func() {
+			err := surgeutil.ConcurrencyCheckWithOptions(reflect.TypeOf(Underestimated(0)), surgeutil.Options{Seed: 1})
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Error()).To(ContainSubstring("goroutine"))
+		})
+	})
+})
@@ -0,0 +1,90 @@
+package surgeutil
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/renproject/surge"
+)
+
+// DefaultRepeats is the number of times that a value is marshaled by
+// DeterminismCheck, unless the options say otherwise.
+const DefaultRepeats = 10
+
+// DeterminismCheck generates a random instance of a type, marshals it into
+// binary several times, unmarshals the result into a new instance of the type,
+// and then marshals the new instance into binary. An error is returned when
+// any of the binary representations are different, reporting the offset of the
+// first byte that is different. Otherwise, it returns nil.
+//
+// Unlike MarshalUnmarshalCheck, this catches non-canonical binary
+// representations that are unmarshaled into equal values, and custom
+// implementations that marshal nondeterministically (for example, by iterating
+// over a map).
+func DeterminismCheck(t reflect.Type) error {
+	return DeterminismCheckWithOptions(t, Options{})
+}
+
+// DeterminismCheckWithOptions is the same as DeterminismCheck, but uses the
+// given options. The number of times that the value is marshaled is given by
+// the Repeats option. When the check fails, an ErrCheckFailed is returned for
+// the smallest value that fails.
+func DeterminismCheckWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, determinism)
+}
+
+func determinism(x reflect.Value, opts Options) error {
+	repeats := opts.Repeats
+	if repeats == 0 {
+		repeats = DefaultRepeats
+	}
+	data, err := surge.ToBinary(x.Interface())
+	if err != nil {
+		return fmt.Errorf("cannot marshal: %w", err)
+	}
+	for i := 1; i < repeats; i++ {
+		other, err := surge.ToBinary(x.Interface())
+		if err != nil {
+			return fmt.Errorf("cannot marshal: %w", err)
+		}
+		if offset := FirstDifference(data, other); offset >= 0 {
+			return fmt.Errorf("marshal %v differs at offset %v: %x != %x", i, offset, other, data)
+		}
+	}
+	y := reflect.New(x.Type())
+	if err := surge.FromBinary(y.Interface(), data); err != nil {
+		return fmt.Errorf("cannot unmarshal: %w", err)
+	}
+	other, err := surge.ToBinary(y.Elem().Interface())
+	if err != nil {
+		return fmt.Errorf("cannot marshal unmarshaled value: %w", err)
+	}
+	if offset := FirstDifference(data, other); offset >= 0 {
+		return fmt.Errorf("marshal after unmarshal differs at offset %v: %x != %x", offset, other, data)
+	}
+	return nil
+}
+
+// FirstDifference returns the offset of the first byte that is different in
+// two byte slices, or -1 if they are equal. When one byte slice is a prefix of
+// the other, the length of the shorter byte slice is returned.
+//
+//  if offset := surgeutil.FirstDifference(expected, actual); offset >= 0 {
+//      t.Errorf("differs at offset %v", offset)
+//  }
+//
+func FirstDifference(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		return n
+	}
+	return -1
+}
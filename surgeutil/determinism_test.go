@@ -0,0 +1,64 @@
+package surgeutil_test
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var stamp uint32
+
+// Stamped is a custom implementation that marshals a different stamp every
+// time that it is marshaled.
+type Stamped struct{}
+
+func (Stamped) SizeHint() int {
+	return surge.SizeHintU32
+}
+
+func (Stamped) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU32(atomic.AddUint32(&stamp, 1), buf, rem)
+}
+
+func (*Stamped) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	x := uint32(0)
+	return surge.UnmarshalU32(&x, buf, rem)
+}
+
+type StampedRecord struct {
+	ID     uint64
+	Stamp  Stamped
+	Values []uint16
+}
+
+var _ = Describe("DeterminismCheck", func() {
+	Context("when marshaling is deterministic", func() {
+		It("should succeed", func() {
+			for _, t := range []reflect.Type{
+				reflect.TypeOf(Record{}),
+				reflect.TypeOf(map[string][]uint16{}),
+				reflect.TypeOf(map[int32]bool{}),
+			} {
+				for trial := 0; trial < 10; trial++ {
+					Expect(surgeutil.DeterminismCheck(t)).To(Succeed())
+				}
+			}
+		})
+	})
+
+	Context("when marshaling is nondeterministic", func() {
+		It("should return an error with the first differing offset", func() {
+			err := surgeutil.DeterminismCheckWithOptions(reflect.TypeOf(StampedRecord{}), surgeutil.Options{Seed: 1, Repeats: 2})
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Error()).To(ContainSubstring("differs at offset 11"))
+			Expect(f.Value).To(Equal(StampedRecord{Values: []uint16{}}))
+		})
+	})
+})
@@ -0,0 +1,188 @@
+package surgeutil
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Diff returns a description of the first difference between two values, or
+// an empty string if they are deeply equal. The description names the path to
+// the first value that is different (for example, value.Tags["a"][2]), shows
+// both values, and explains common pitfalls:
+//
+//  - nil and empty slices (or maps) have the same binary representation, so
+//    they cannot both survive a round-trip,
+//  - NaN is not equal to itself, so values that contain NaN are never deeply
+//    equal, even after a perfect round-trip, and
+//  - unexported fields are often skipped by custom implementations.
+func Diff(expected, actual interface{}) string {
+	return diff("value", reflect.ValueOf(expected), reflect.ValueOf(actual), "", false)
+}
+
+// bitwiseDiff is the same as Diff, but compares floats by their bits. A NaN is
+// equal to a NaN with the same bits, and negative zero is not equal to zero, so
+// it can be used to check that generated values survive a round-trip.
+func bitwiseDiff(expected, actual interface{}) string {
+	return diff("value", reflect.ValueOf(expected), reflect.ValueOf(actual), "", true)
+}
+
+func diff(path string, x, y reflect.Value, note string, bitwise bool) string {
+	if !x.IsValid() || !y.IsValid() {
+		if x.IsValid() == y.IsValid() {
+			return ""
+		}
+		return difference(path, x, y, note)
+	}
+	if x.Type() != y.Type() {
+		return difference(path, x, y, fmt.Sprintf("expected type %v, got type %v", x.Type(), y.Type()))
+	}
+
+	switch x.Kind() {
+	case reflect.Bool:
+		if x.Bool() != y.Bool() {
+			return difference(path, x, y, note)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if x.Int() != y.Int() {
+			return difference(path, x, y, note)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if x.Uint() != y.Uint() {
+			return difference(path, x, y, note)
+		}
+	case reflect.Float32, reflect.Float64:
+		if bitwise {
+			if math.Float64bits(x.Float()) != math.Float64bits(y.Float()) {
+				return difference(path, x, y, note)
+			}
+			break
+		}
+		if math.IsNaN(x.Float()) || math.IsNaN(y.Float()) {
+			return difference(path, x, y, join(note, "NaN is not equal to itself, so values that contain NaN are never deeply equal"))
+		}
+		if x.Float() != y.Float() {
+			return difference(path, x, y, note)
+		}
+	case reflect.Complex64, reflect.Complex128:
+		if bitwise {
+			cx, cy := x.Complex(), y.Complex()
+			if math.Float64bits(real(cx)) != math.Float64bits(real(cy)) || math.Float64bits(imag(cx)) != math.Float64bits(imag(cy)) {
+				return difference(path, x, y, note)
+			}
+			break
+		}
+		if c := x.Complex(); math.IsNaN(real(c)) || math.IsNaN(imag(c)) {
+			return difference(path, x, y, join(note, "NaN is not equal to itself, so values that contain NaN are never deeply equal"))
+		}
+		if x.Complex() != y.Complex() {
+			return difference(path, x, y, note)
+		}
+	case reflect.String:
+		if x.String() != y.String() {
+			return difference(path, x, y, note)
+		}
+	case reflect.Array:
+		for i := 0; i < x.Len(); i++ {
+			if d := diff(fmt.Sprintf("%v[%v]", path, i), x.Index(i), y.Index(i), note, bitwise); d != "" {
+				return d
+			}
+		}
+	case reflect.Slice:
+		if x.IsNil() != y.IsNil() {
+			return difference(path, x, y, join(note, nilOrEmpty(x, y, "slices")))
+		}
+		n := x.Len()
+		if y.Len() < n {
+			n = y.Len()
+		}
+		for i := 0; i < n; i++ {
+			if d := diff(fmt.Sprintf("%v[%v]", path, i), x.Index(i), y.Index(i), note, bitwise); d != "" {
+				return d
+			}
+		}
+		if x.Len() != y.Len() {
+			return difference(path, x, y, join(note, fmt.Sprintf("expected length %v, got length %v", x.Len(), y.Len())))
+		}
+	case reflect.Map:
+		if x.IsNil() != y.IsNil() {
+			return difference(path, x, y, join(note, nilOrEmpty(x, y, "maps")))
+		}
+		for _, key := range sortedKeys(x) {
+			keyPath := fmt.Sprintf("%v[%#v]", path, key)
+			elem := y.MapIndex(key)
+			if !elem.IsValid() {
+				return difference(keyPath, x.MapIndex(key), elem, join(note, "missing map key"))
+			}
+			if d := diff(keyPath, x.MapIndex(key), elem, note, bitwise); d != "" {
+				return d
+			}
+		}
+		for _, key := range sortedKeys(y) {
+			if !x.MapIndex(key).IsValid() {
+				return difference(fmt.Sprintf("%v[%#v]", path, key), reflect.Value{}, y.MapIndex(key), join(note, "unexpected map key"))
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			field := x.Type().Field(i)
+			fieldNote := note
+			if field.PkgPath != "" {
+				fieldNote = join(note, "unexported field, which custom implementations often skip")
+			}
+			if d := diff(path+"."+field.Name, x.Field(i), y.Field(i), fieldNote, bitwise); d != "" {
+				return d
+			}
+		}
+	case reflect.Ptr, reflect.Interface:
+		if x.IsNil() != y.IsNil() {
+			return difference(path, x, y, note)
+		}
+		if !x.IsNil() {
+			return diff(path, x.Elem(), y.Elem(), note, bitwise)
+		}
+	default:
+		if x.Pointer() != y.Pointer() {
+			return difference(path, x, y, note)
+		}
+	}
+	return ""
+}
+
+// difference describes a difference at a path.
+func difference(path string, x, y reflect.Value, note string) string {
+	str := fmt.Sprintf("%v: expected %v, got %v", path, format(x), format(y))
+	if note != "" {
+		str += " (" + note + ")"
+	}
+	return str
+}
+
+// format a value, including values of unexported fields (which cannot be
+// converted into interfaces).
+func format(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nothing"
+	}
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.IsNil() {
+		return fmt.Sprintf("%v(nil)", v.Type())
+	}
+	return fmt.Sprintf("%#v", v)
+}
+
+func nilOrEmpty(x, y reflect.Value, kind string) string {
+	if x.Len() == 0 && y.Len() == 0 {
+		return fmt.Sprintf("nil and empty %v have the same binary representation", kind)
+	}
+	return ""
+}
+
+func join(note, other string) string {
+	switch {
+	case note == "":
+		return other
+	case other == "":
+		return note
+	}
+	return note + "; " + other
+}
@@ -0,0 +1,82 @@
+package surgeutil_test
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diff", func() {
+	Context("when values are deeply equal", func() {
+		It("should return an empty string", func() {
+			x := Record{ID: 1, Tags: map[string][]uint16{"a": {1, 2}}, Notes: []string{"b"}}
+			y := Record{ID: 1, Tags: map[string][]uint16{"a": {1, 2}}, Notes: []string{"b"}}
+			Expect(surgeutil.Diff(x, y)).To(BeEmpty())
+		})
+	})
+
+	Context("when values are different", func() {
+		It("should name the path to the first difference", func() {
+			x := Record{ID: 1, Tags: map[string][]uint16{"a": {1, 2}, "b": {3}}}
+			y := Record{ID: 1, Tags: map[string][]uint16{"a": {1, 5}, "b": {4}}}
+			Expect(surgeutil.Diff(x, y)).To(Equal(`value.Tags["a"][1]: expected 0x2, got 0x5`))
+		})
+
+		It("should report slices of different lengths", func() {
+			Expect(surgeutil.Diff([]uint8{1, 2}, []uint8{1})).To(ContainSubstring("expected length 2, got length 1"))
+		})
+
+		It("should report missing and unexpected map keys", func() {
+			Expect(surgeutil.Diff(map[string]bool{"a": true}, map[string]bool{})).To(Equal(`value["a"]: expected true, got nothing (missing map key)`))
+			Expect(surgeutil.Diff(map[string]bool{}, map[string]bool{"a": true})).To(Equal(`value["a"]: expected nothing, got true (unexpected map key)`))
+		})
+	})
+
+	Context("when a nil slice or map becomes empty", func() {
+		It("should explain that nil and empty have the same binary representation", func() {
+			type Envelope struct {
+				Payload []byte
+				Headers map[string]string
+			}
+			Expect(surgeutil.Diff(Envelope{Headers: map[string]string{}}, Envelope{Payload: []byte{}, Headers: map[string]string{}})).To(Equal(
+				"value.Payload: expected []uint8(nil), got []uint8{} (nil and empty slices have the same binary representation)",
+			))
+			Expect(surgeutil.Diff(Envelope{Payload: []byte{}}, Envelope{Payload: []byte{}, Headers: map[string]string{}})).To(ContainSubstring(
+				"nil and empty maps have the same binary representation",
+			))
+		})
+	})
+
+	Context("when a value contains NaN", func() {
+		It("should explain that NaN is not equal to itself", func() {
+			x := []float64{1, math.NaN()}
+			y := []float64{1, math.NaN()}
+			Expect(reflect.DeepEqual(x, y)).To(BeFalse())
+			Expect(surgeutil.Diff(x, y)).To(And(HavePrefix("value[1]"), ContainSubstring("NaN is not equal to itself")))
+		})
+	})
+
+	Context("when an unexported field is different", func() {
+		It("should explain that it is unexported", func() {
+			type Account struct {
+				Name    string
+				balance uint64
+			}
+			Expect(surgeutil.Diff(Account{"a", 10}, Account{"a", 0})).To(Equal(
+				"value.balance: expected 0xa, got 0x0 (unexported field, which custom implementations often skip)",
+			))
+		})
+	})
+
+	Context("when a round-trip is unequal", func() {
+		It("should report the structural diff", func() {
+			err := surgeutil.MarshalUnmarshalCheckWithOptions(reflect.TypeOf([]Forgetful{}), surgeutil.Options{Seed: 1})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unequal: value[0]: expected 0x1, got 0x0"))
+		})
+	})
+})
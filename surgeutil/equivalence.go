@@ -0,0 +1,82 @@
+package surgeutil
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/renproject/surge"
+)
+
+// EquivalenceCheck generates a random instance of a type that has a custom
+// implementation, and then checks that the custom implementation is equivalent
+// to the default reflective implementation: the size hints must be equal, the
+// binary representations must be equal, and each implementation must be able
+// to unmarshal the binary representation of the other. An error is returned
+// when they are not equivalent, naming the first field that is different.
+// Otherwise, it returns nil.
+//
+// This makes it safe to replace the default reflective implementation of a
+// type with a hand-written one (for performance), or vice versa.
+func EquivalenceCheck(t reflect.Type) error {
+	return EquivalenceCheckWithOptions(t, Options{})
+}
+
+// EquivalenceCheckWithOptions is the same as EquivalenceCheck, but uses the
+// given options. When the check fails, an ErrCheckFailed is returned for the
+// smallest value that fails.
+func EquivalenceCheckWithOptions(t reflect.Type, opts Options) error {
+	if !surge.HasCustomImplementation(t) {
+		return fmt.Errorf("type %v does not have a custom implementation", t)
+	}
+	return check(t, opts, equivalence)
+}
+
+func equivalence(x reflect.Value, opts Options) error {
+	// Marshal
+	custom, err := encode(x.Interface(), surge.SizeHint(x.Interface()))
+	if err != nil {
+		return fmt.Errorf("cannot marshal with the custom implementation: %w", err)
+	}
+	sizeHint := surge.SizeHintReflected(x.Interface())
+	reflected := make([]byte, sizeHint)
+	tail, _, err := surge.MarshalReflected(x.Interface(), reflected, surge.MaxBytes)
+	if err != nil {
+		return fmt.Errorf("cannot marshal with the reflective implementation: %w", err)
+	}
+	reflected = reflected[:len(reflected)-len(tail)]
+
+	// Compare
+	if offset := FirstDifference(reflected, custom); offset >= 0 {
+		desc := fmt.Sprintf("binary representations differ at offset %v: custom %x, reflective %x", offset, custom, reflected)
+		// Unmarshaling the custom binary representation reflectively names
+		// the first field that is different.
+		y := reflect.New(x.Type())
+		if _, _, err := surge.UnmarshalReflected(y.Interface(), custom, surge.MaxBytes); err != nil {
+			return fmt.Errorf("%v; cannot unmarshal the custom binary representation reflectively: %w", desc, err)
+		}
+		if d := bitwiseDiff(x.Interface(), y.Elem().Interface()); d != "" {
+			return fmt.Errorf("%v; unmarshaled reflectively, %v", desc, d)
+		}
+		return fmt.Errorf("%v", desc)
+	}
+	if customSizeHint := surge.SizeHint(x.Interface()); customSizeHint != sizeHint {
+		return fmt.Errorf("size hints differ: custom %v, reflective %v", customSizeHint, sizeHint)
+	}
+
+	// Unmarshal
+	y := reflect.New(x.Type())
+	if _, _, err := surge.Unmarshal(y.Interface(), reflected, surge.MaxBytes); err != nil {
+		return fmt.Errorf("cannot unmarshal the reflective binary representation with the custom implementation: %w", err)
+	}
+	if d := bitwiseDiff(x.Interface(), y.Elem().Interface()); d != "" {
+		return fmt.Errorf("unmarshaled the reflective binary representation with the custom implementation, %v", d)
+	}
+	z := reflect.New(x.Type())
+	if _, _, err := surge.UnmarshalReflected(z.Interface(), custom, surge.MaxBytes); err != nil {
+		return fmt.Errorf("cannot unmarshal the custom binary representation with the reflective implementation: %w", err)
+	}
+	if d := bitwiseDiff(x.Interface(), z.Elem().Interface()); d != "" {
+		return fmt.Errorf("unmarshaled the custom binary representation with the reflective implementation, %v", d)
+	}
+	return nil
+}
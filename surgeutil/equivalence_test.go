@@ -0,0 +1,110 @@
+package surgeutil_test
+
+import (
+	"reflect"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Point is a custom implementation that is equivalent to the reflective
+// implementation.
+type Point struct {
+	X, Y int32
+}
+
+func (p Point) SizeHint() int {
+	return 2 * surge.SizeHintI32
+}
+
+func (p Point) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.MarshalI32(p.X, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	return surge.MarshalI32(p.Y, buf, rem)
+}
+
+func (p *Point) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.UnmarshalI32(&p.X, buf, rem)
+	if err != nil {
+		return buf, rem, err
+	}
+	return surge.UnmarshalI32(&p.Y, buf, rem)
+}
+
+// Labeled is a custom implementation that marshals its fields in a different
+// order to the reflective implementation.
+type Labeled struct {
+	ID    uint32
+	Label uint32
+	Score uint32
+}
+
+func (l Labeled) SizeHint() int {
+	return 3 * surge.SizeHintU32
+}
+
+func (l Labeled) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	for _, x := range []uint32{l.ID, l.Score, l.Label} {
+		var err error
+		if buf, rem, err = surge.MarshalU32(x, buf, rem); err != nil {
+			return buf, rem, err
+		}
+	}
+	return buf, rem, nil
+}
+
+func (l *Labeled) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	for _, x := range []*uint32{&l.ID, &l.Score, &l.Label} {
+		var err error
+		if buf, rem, err = surge.UnmarshalU32(x, buf, rem); err != nil {
+			return buf, rem, err
+		}
+	}
+	return buf, rem, nil
+}
+
+var _ = Describe("EquivalenceCheck", func() {
+	Context("when the custom implementation is equivalent", func() {
+		It("should succeed", func() {
+			for trial := 0; trial < 10; trial++ {
+				Expect(surgeutil.EquivalenceCheck(reflect.TypeOf(Point{}))).To(Succeed())
+			}
+		})
+	})
+
+	Context("when the custom implementation marshals fields in a different order", func() {
+		It("should name the first field that is different", func() {
+			err := surgeutil.EquivalenceCheckWithOptions(reflect.TypeOf(Labeled{}), surgeutil.Options{Seed: 1})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("binary representations differ at offset 7"))
+			Expect(err.Error()).To(ContainSubstring("value.Label"))
+		})
+	})
+
+	Context("when the size hints are different", func() {
+		It("should return an error", func() {
+			err := surgeutil.EquivalenceCheck(reflect.TypeOf(Overestimated(0)))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("size hints differ: custom 12, reflective 8"))
+		})
+	})
+
+	Context("when the custom implementation does not round-trip reflective binary representations", func() {
+		It("should return an error", func() {
+			err := surgeutil.EquivalenceCheckWithOptions(reflect.TypeOf(Forgetful(0)), surgeutil.Options{Seed: 1})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("with the custom implementation"))
+		})
+	})
+
+	Context("when the type does not have a custom implementation", func() {
+		It("should return an error", func() {
+			Expect(surgeutil.EquivalenceCheck(reflect.TypeOf(Record{}))).ToNot(Succeed())
+		})
+	})
+})
@@ -0,0 +1,114 @@
+package surgeutil
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/renproject/surge"
+)
+
+// DefaultCorpusSize is the number of random values whose binary
+// representations are added to the seed corpus of a fuzz test, unless the
+// options say otherwise.
+const DefaultCorpusSize = 10
+
+// FuzzMaxBytes is the memory quota used by UnmarshalCheck. It is smaller than
+// surge.MaxBytes, so that length prefixes that claim large amounts of memory do
+// not slow down fuzzing.
+const FuzzMaxBytes = 1024 * 1024
+
+// AddCorpus adds the binary representations of random instances of a type to
+// the seed corpus of a fuzz test, along with truncations of these binary
+// representations. The number of instances is given by the CorpusSize option,
+// and the number of truncations of each instance by the Steps option (a value
+// of 0 means that all truncations are added).
+func AddCorpus(f *testing.F, t reflect.Type, opts Options) {
+	f.Helper()
+	r, seed, err := newRand(opts)
+	if err != nil {
+		f.Fatal(err)
+	}
+	n := opts.CorpusSize
+	if n == 0 {
+		n = DefaultCorpusSize
+	}
+	for i := 0; i < n; i++ {
+		x, err := Generate(t, r, opts)
+		if err != nil {
+			f.Fatal(err)
+		}
+		data, err := surge.ToBinary(x.Interface())
+		if err != nil {
+			f.Fatal(NewErrCheckFailed(seed, x.Interface(), nil, fmt.Errorf("cannot marshal: %v", err)))
+		}
+		f.Add(data)
+		step := stepSize(len(data), opts.Steps)
+		for bufLen := 0; bufLen < len(data); bufLen += step {
+			f.Add(data[:bufLen])
+		}
+	}
+}
+
+// FuzzUnmarshal seeds the corpus of a fuzz test using AddCorpus, and then
+// fuzzes the unmarshaling of a type using UnmarshalCheck.
+//
+//  func FuzzBlock(f *testing.F) {
+//      surgeutil.FuzzUnmarshal(f, reflect.TypeOf(Block{}), surgeutil.Options{})
+//  }
+//
+func FuzzUnmarshal(f *testing.F, t reflect.Type, opts Options) {
+	f.Helper()
+	AddCorpus(f, t, opts)
+	f.Fuzz(func(tt *testing.T, data []byte) {
+		if err := UnmarshalCheck(t, data); err != nil {
+			tt.Fatal(err)
+		}
+	})
+}
+
+// UnmarshalCheck attempts to unmarshal bytes into a new instance of a type, in
+// strict mode and with a memory quota of FuzzMaxBytes, and checks that:
+//
+//  - unmarshaling does not panic,
+//  - the unconsumed tail is a suffix of the bytes,
+//  - the remaining memory quota is not negative, and at least as many bytes of
+//    memory quota were consumed as bytes of input, and
+//  - marshaling the instance reproduces the consumed bytes exactly.
+//
+// It returns an error if any of these properties do not hold. Errors returned
+// by unmarshaling are ignored, because it is expected that most bytes will not
+// be valid binary representations.
+func UnmarshalCheck(t reflect.Type, data []byte) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = NewErrCheckFailed(0, nil, data, fmt.Errorf("unmarshal %v panicked: %v", t, p))
+		}
+	}()
+
+	codec := surge.NewCodec(surge.Options{MaxBytes: FuzzMaxBytes, Strict: true})
+	x := reflect.New(t)
+	tail, rem, unmarshalErr := codec.Unmarshal(x.Interface(), data, FuzzMaxBytes)
+	if unmarshalErr != nil {
+		return nil
+	}
+	if len(tail) > len(data) || !bytes.Equal(tail, data[len(data)-len(tail):]) {
+		return NewErrCheckFailed(0, x.Elem().Interface(), data, fmt.Errorf("tail is not a suffix"))
+	}
+	consumed := len(data) - len(tail)
+	if rem < 0 {
+		return NewErrCheckFailed(0, x.Elem().Interface(), data, fmt.Errorf("negative remaining memory quota: %v", rem))
+	}
+	if FuzzMaxBytes-rem < consumed {
+		return NewErrCheckFailed(0, x.Elem().Interface(), data, fmt.Errorf("consumed %v bytes, but only %v bytes of memory quota", consumed, FuzzMaxBytes-rem))
+	}
+	reencoded, err := codec.ToBinary(x.Elem().Interface())
+	if err != nil {
+		return NewErrCheckFailed(0, x.Elem().Interface(), data, fmt.Errorf("cannot marshal: %v", err))
+	}
+	if !bytes.Equal(reencoded, data[:consumed]) {
+		return NewErrCheckFailed(0, x.Elem().Interface(), data, fmt.Errorf("marshaled to %x, but consumed %x", reencoded, data[:consumed]))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package surgeutil_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type Record struct {
+	ID     uint64
+	Active bool
+	Tags   map[string][]uint16
+	Scores [3]float32
+	Notes  []string
+}
+
+// Greedy is a custom implementation that consumes the rest of the buffer when
+// it is unmarshaled.
+type Greedy []byte
+
+func (g Greedy) SizeHint() int {
+	return len(g)
+}
+
+func (g Greedy) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	if len(buf) < len(g) || rem < len(g) {
+		return buf, rem, surge.ErrUnexpectedEndOfBuffer
+	}
+	copy(buf, g)
+	return buf[len(g):], rem - len(g), nil
+}
+
+func (g *Greedy) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	*g = append((*g)[:0], buf...)
+	return buf[len(buf):], rem, nil
+}
+
+func FuzzRecord(f *testing.F) {
+	surgeutil.FuzzUnmarshal(f, reflect.TypeOf(Record{}), surgeutil.Options{Steps: 10})
+}
+
+func FuzzMap(f *testing.F) {
+	surgeutil.FuzzUnmarshal(f, reflect.TypeOf(map[string][]uint16{}), surgeutil.Options{CorpusSize: 5, Steps: 10})
+}
+
+var _ = Describe("UnmarshalCheck", func() {
+	checkFailed := func(err error) surgeutil.ErrCheckFailed {
+		f := surgeutil.ErrCheckFailed{}
+		Expect(errors.As(err, &f)).To(BeTrue())
+		return f
+	}
+
+	Context("when the bytes are valid", func() {
+		It("should succeed", func() {
+			data, err := surge.ToBinary(Record{ID: 1, Tags: map[string][]uint16{"a": {1}, "b": {}}, Notes: []string{"x"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(surgeutil.UnmarshalCheck(reflect.TypeOf(Record{}), append(data, 1, 2, 3))).To(Succeed())
+		})
+	})
+
+	Context("when the bytes are invalid", func() {
+		It("should succeed", func() {
+			Expect(surgeutil.UnmarshalCheck(reflect.TypeOf(Record{}), []byte{1, 2, 3})).To(Succeed())
+			Expect(surgeutil.UnmarshalCheck(reflect.TypeOf(Record{}), nil)).To(Succeed())
+		})
+	})
+
+	Context("when unmarshaling panics", func() {
+		It("should return an error", func() {
+			f := checkFailed(surgeutil.UnmarshalCheck(reflect.TypeOf(Panicky{}), []byte{1}))
+			Expect(f.Data).To(Equal([]byte{1}))
+			Expect(f.Error()).To(ContainSubstring("panicked"))
+		})
+	})
+
+	Context("when marshaling does not reproduce the consumed bytes", func() {
+		It("should return an error", func() {
+			f := checkFailed(surgeutil.UnmarshalCheck(reflect.TypeOf(Forgetful(0)), []byte{0, 0, 0, 0, 0, 0, 0, 1}))
+			Expect(f.Error()).To(ContainSubstring("marshaled to"))
+		})
+	})
+
+	Context("when the memory quota is not consumed", func() {
+		It("should return an error", func() {
+			f := checkFailed(surgeutil.UnmarshalCheck(reflect.TypeOf(Greedy{}), []byte{1, 2, 3}))
+			Expect(f.Error()).To(ContainSubstring("memory quota"))
+		})
+	})
+})
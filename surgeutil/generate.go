@@ -0,0 +1,239 @@
+package surgeutil
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing/quick"
+	"unicode/utf8"
+
+	"github.com/renproject/surge"
+)
+
+// DefaultMaxSize is the maximum length of generated strings, slices, and maps,
+// unless the options say otherwise.
+const DefaultMaxSize = 50
+
+// DefaultMaxDepth is the maximum depth of generated values, unless the options
+// say otherwise. Strings, slices, and maps that are deeper are empty, and
+// pointers that are deeper are nil.
+const DefaultMaxDepth = 4
+
+// A Generator returns a random value. The size is the maximum length of the
+// strings, slices, and maps that it generates.
+type Generator func(r *rand.Rand, size int) reflect.Value
+
+var (
+	generatorsMu = new(sync.RWMutex)
+	generators   = map[reflect.Type]Generator{}
+
+	quickGenerator = reflect.TypeOf((*quick.Generator)(nil)).Elem()
+)
+
+// RegisterGenerator registers a generator for a type. Values of the type are
+// always generated using this generator, even when the type implements
+// quick.Generator. This is useful for domain types that have invariants which
+// their binary representations must respect, and which are not owned by the
+// package that tests them. Registering a nil generator removes the generator
+// for the type.
+func RegisterGenerator(t reflect.Type, gen Generator) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+
+	if gen == nil {
+		delete(generators, t)
+		return
+	}
+	generators[t] = gen
+}
+
+// Generate a random value of a type. Values are generated using registered
+// generators, the quick.Generator interface, or reflection (in that order).
+// Reflection respects the surge struct tags: strings and byte slices with a
+// fixed length are generated with exactly that length, and strings, slices,
+// and maps with a maximum length are generated no longer than that length.
+// Unexported struct fields, and interfaces, are left as zero values.
+//
+// The length of strings, slices, and maps is at most the MaxSize option, and
+// halves with every level of depth, so that recursive types are generated
+// with a bounded number of elements. The depth is at most the MaxDepth option.
+func Generate(t reflect.Type, r *rand.Rand, opts Options) (reflect.Value, error) {
+	g := generator{r: r, maxSize: opts.MaxSize, maxDepth: opts.MaxDepth}
+	if g.maxSize == 0 {
+		g.maxSize = DefaultMaxSize
+	}
+	if g.maxDepth == 0 {
+		g.maxDepth = DefaultMaxDepth
+	}
+	v := reflect.New(t).Elem()
+	if err := g.generate(v, 0, surge.Tag{}); err != nil {
+		return reflect.Value{}, err
+	}
+	return v, nil
+}
+
+type generator struct {
+	r        *rand.Rand
+	maxSize  int
+	maxDepth int
+	noNaN    bool
+}
+
+func (g generator) generate(v reflect.Value, depth int, tag surge.Tag) error {
+	t := v.Type()
+	size := g.maxSize >> uint(depth)
+
+	generatorsMu.RLock()
+	gen, ok := generators[t]
+	generatorsMu.RUnlock()
+	if ok {
+		v.Set(gen(g.r, size))
+		return nil
+	}
+	if t.Implements(quickGenerator) {
+		v.Set(v.Interface().(quick.Generator).Generate(g.r, size))
+		return nil
+	}
+	if reflect.PtrTo(t).Implements(quickGenerator) {
+		v.Set(reflect.New(t).Interface().(quick.Generator).Generate(g.r, size))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		v.SetBool(g.r.Intn(2) == 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(g.r.Uint64()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(g.r.Uint64())
+	case reflect.Float32:
+		v.SetFloat(g.float(math.MaxFloat32, math.SmallestNonzeroFloat32))
+	case reflect.Float64:
+		v.SetFloat(g.float(math.MaxFloat64, math.SmallestNonzeroFloat64))
+	case reflect.Complex64:
+		v.SetComplex(complex(g.float(math.MaxFloat32, math.SmallestNonzeroFloat32), g.float(math.MaxFloat32, math.SmallestNonzeroFloat32)))
+	case reflect.Complex128:
+		v.SetComplex(complex(g.float(math.MaxFloat64, math.SmallestNonzeroFloat64), g.float(math.MaxFloat64, math.SmallestNonzeroFloat64)))
+	case reflect.String:
+		if tag.Fixed > 0 {
+			v.SetString(string(g.bytes(tag.Fixed)))
+			return nil
+		}
+		// The maximum length of a string is in bytes, not runes.
+		n := g.length(size, depth, tag)
+		str := make([]byte, 0, n)
+		for i := 0; i < n; i++ {
+			next := utf8.AppendRune(str, rune(g.r.Intn(0x10ffff)))
+			if tag.MaxLen > 0 && len(next) > tag.MaxLen {
+				break
+			}
+			str = next
+		}
+		v.SetString(string(str))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := g.generate(v.Index(i), depth+1, surge.Tag{}); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if tag.Fixed > 0 && t.Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(g.bytes(tag.Fixed))
+			return nil
+		}
+		n := g.length(size, depth, tag)
+		v.Set(reflect.MakeSlice(t, n, n))
+		for i := 0; i < n; i++ {
+			if err := g.generate(v.Index(i), depth+1, surge.Tag{}); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		n := g.length(size, depth, tag)
+		v.Set(reflect.MakeMapWithSize(t, n))
+		for i := 0; i < n; i++ {
+			// A NaN can never be found in a map, so it is not used in keys.
+			keys := g
+			keys.noNaN = true
+			key := reflect.New(t.Key()).Elem()
+			if err := keys.generate(key, depth+1, surge.Tag{}); err != nil {
+				return err
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err := g.generate(elem, depth+1, surge.Tag{}); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldTag, err := surge.FieldTag(field)
+			if err != nil {
+				return err
+			}
+			if err := g.generate(v.Field(i), depth+1, fieldTag); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if depth >= g.maxDepth || g.r.Intn(2) == 0 {
+			return nil
+		}
+		v.Set(reflect.New(t.Elem()))
+		return g.generate(v.Elem(), depth+1, tag)
+	case reflect.Interface:
+	default:
+		return fmt.Errorf("cannot generate value of type %v", t)
+	}
+	return nil
+}
+
+// length returns a random length for a string, slice, or map.
+func (g generator) length(size, depth int, tag surge.Tag) int {
+	if depth >= g.maxDepth {
+		return 0
+	}
+	if tag.MaxLen > 0 && tag.MaxLen < size {
+		size = tag.MaxLen
+	}
+	return g.r.Intn(size + 1)
+}
+
+func (g generator) bytes(n int) []byte {
+	bs := make([]byte, n)
+	g.r.Read(bs)
+	return bs
+}
+
+// float returns a random float no bigger than max. Sometimes, it returns a
+// special float instead, because these are often handled incorrectly: NaN,
+// infinities, negative zero, and subnormal multiples of smallest.
+func (g generator) float(max, smallest float64) float64 {
+	if g.r.Intn(16) == 0 {
+		switch g.r.Intn(5) {
+		case 0:
+			if !g.noNaN {
+				return math.NaN()
+			}
+		case 1:
+			return math.Inf(1)
+		case 2:
+			return math.Inf(-1)
+		case 3:
+			return math.Copysign(0, -1)
+		case 4:
+			return smallest * float64(1+g.r.Intn(1<<20))
+		}
+	}
+	f := g.r.Float64() * max
+	if g.r.Intn(2) == 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,237 @@
+package surgeutil_test
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"unicode/utf8"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Tree is a recursive type, which cannot be generated by the quick package.
+type Tree struct {
+	Value    uint32
+	Children []Tree
+}
+
+func (tree Tree) depth() int {
+	depth := 0
+	for _, child := range tree.Children {
+		if d := child.depth(); d > depth {
+			depth = d
+		}
+	}
+	return depth + 1
+}
+
+// Even is a custom implementation that can only unmarshal even numbers.
+type Even uint32
+
+func (e Even) SizeHint() int {
+	return surge.SizeHintU32
+}
+
+func (e Even) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU32(uint32(e), buf, rem)
+}
+
+func (e *Even) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.UnmarshalU32((*uint32)(e), buf, rem)
+	if err == nil && *e%2 != 0 {
+		return buf, rem, errors.New("odd")
+	}
+	return buf, rem, err
+}
+
+// Odd is a custom implementation that can only unmarshal odd numbers, and
+// generates itself.
+type Odd uint32
+
+func (o Odd) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(Odd(2*r.Uint32() + 1))
+}
+
+func (o Odd) SizeHint() int {
+	return surge.SizeHintU32
+}
+
+func (o Odd) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU32(uint32(o), buf, rem)
+}
+
+func (o *Odd) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.UnmarshalU32((*uint32)(o), buf, rem)
+	if err == nil && *o%2 == 0 {
+		return buf, rem, errors.New("even")
+	}
+	return buf, rem, err
+}
+
+var _ = Describe("Generate", func() {
+	generate := func(t reflect.Type, r *rand.Rand, opts surgeutil.Options) interface{} {
+		x, err := surgeutil.Generate(t, r, opts)
+		Expect(err).ToNot(HaveOccurred())
+		return x.Interface()
+	}
+
+	Context("when generating recursive types", func() {
+		It("should respect the maximum depth", func() {
+			r := rand.New(rand.NewSource(1))
+			for trial := 0; trial < 100; trial++ {
+				tree := generate(reflect.TypeOf(Tree{}), r, surgeutil.Options{}).(Tree)
+				Expect(tree.depth()).To(BeNumerically("<=", surgeutil.DefaultMaxDepth/2+1))
+				tree = generate(reflect.TypeOf(Tree{}), r, surgeutil.Options{MaxDepth: 2}).(Tree)
+				Expect(tree.depth()).To(BeNumerically("<=", 2))
+			}
+			recorder := &recorder{}
+			surgeutil.CheckAll(recorder, reflect.TypeOf(Tree{}), surgeutil.Options{Steps: 10})
+			Expect(recorder.errors).To(BeEmpty())
+		})
+	})
+
+	Context("when generating strings, slices, and maps", func() {
+		It("should respect the maximum size", func() {
+			r := rand.New(rand.NewSource(2))
+			for trial := 0; trial < 100; trial++ {
+				Expect(len(generate(reflect.TypeOf([]uint8{}), r, surgeutil.Options{}).([]uint8))).To(BeNumerically("<=", surgeutil.DefaultMaxSize))
+				Expect(len(generate(reflect.TypeOf(map[uint8]bool{}), r, surgeutil.Options{MaxSize: 3}).(map[uint8]bool))).To(BeNumerically("<=", 3))
+				Expect(utf8.RuneCountInString(generate(reflect.TypeOf(""), r, surgeutil.Options{MaxSize: 5}).(string))).To(BeNumerically("<=", 5))
+			}
+		})
+	})
+
+	Context("when generating structs with surge tags", func() {
+		It("should respect fixed and maximum lengths", func() {
+			r := rand.New(rand.NewSource(3))
+			for trial := 0; trial < 100; trial++ {
+				tagged := generate(reflect.TypeOf(Tagged{}), r, surgeutil.Options{}).(Tagged)
+				Expect(tagged.Hash).To(HaveLen(8))
+				Expect(len(tagged.Name)).To(BeNumerically("<=", 32))
+			}
+		})
+
+		It("should not generate unexported fields", func() {
+			type private struct {
+				Exported   uint64
+				unexported uint64
+			}
+			r := rand.New(rand.NewSource(4))
+			for trial := 0; trial < 10; trial++ {
+				Expect(generate(reflect.TypeOf(private{}), r, surgeutil.Options{}).(private).unexported).To(BeZero())
+			}
+		})
+
+		It("should return an error when a tag is invalid", func() {
+			type invalid struct {
+				X uint64 `surge:"maxlen=4"`
+			}
+			_, err := surgeutil.Generate(reflect.TypeOf(invalid{}), rand.New(rand.NewSource(9)), surgeutil.Options{})
+			Expect(err).To(BeAssignableToTypeOf(surge.ErrInvalidTag{}))
+		})
+	})
+
+	Context("when generating floats", func() {
+		It("should sometimes generate NaN, infinities, negative zero, and subnormals", func() {
+			r := rand.New(rand.NewSource(10))
+			nans, infs, negativeZeros, subnormals := 0, 0, 0, 0
+			for trial := 0; trial < 1000; trial++ {
+				f := generate(reflect.TypeOf(float64(0)), r, surgeutil.Options{}).(float64)
+				switch {
+				case math.IsNaN(f):
+					nans++
+				case math.IsInf(f, 0):
+					infs++
+				case f == 0 && math.Signbit(f):
+					negativeZeros++
+				case f != 0 && math.Abs(f) < 0x1p-1022:
+					subnormals++
+				}
+			}
+			Expect(nans).To(BeNumerically(">", 0))
+			Expect(infs).To(BeNumerically(">", 0))
+			Expect(negativeZeros).To(BeNumerically(">", 0))
+			Expect(subnormals).To(BeNumerically(">", 0))
+		})
+
+		It("should round-trip them", func() {
+			type floats struct {
+				F32 float32
+				F64 float64
+				Map map[float64]float32
+			}
+			for seed := int64(1); seed <= 10; seed++ {
+				Expect(surgeutil.MarshalUnmarshalCheckWithOptions(reflect.TypeOf(floats{}), surgeutil.Options{Seed: seed})).To(Succeed())
+			}
+		})
+	})
+
+	Context("when generating pointers and interfaces", func() {
+		It("should generate nil and non-nil pointers, and nil interfaces", func() {
+			type pointers struct {
+				Pointer   *uint64
+				Interface interface{}
+			}
+			r := rand.New(rand.NewSource(5))
+			nils := 0
+			for trial := 0; trial < 100; trial++ {
+				x := generate(reflect.TypeOf(pointers{}), r, surgeutil.Options{}).(pointers)
+				if x.Pointer == nil {
+					nils++
+				}
+				Expect(x.Interface).To(BeNil())
+			}
+			Expect(nils).To(And(BeNumerically(">", 0), BeNumerically("<", 100)))
+		})
+	})
+
+	Context("when a type implements quick.Generator", func() {
+		It("should use it", func() {
+			Expect(surgeutil.MarshalUnmarshalCheck(reflect.TypeOf([]Odd{}))).To(Succeed())
+		})
+	})
+
+	Context("when a generator is registered", func() {
+		AfterEach(func() {
+			surgeutil.RegisterGenerator(reflect.TypeOf(Even(0)), nil)
+			surgeutil.RegisterGenerator(reflect.TypeOf(Odd(0)), nil)
+		})
+
+		It("should use it", func() {
+			t := reflect.TypeOf([]Even{})
+			Expect(surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: 1})).ToNot(Succeed())
+			surgeutil.RegisterGenerator(reflect.TypeOf(Even(0)), func(r *rand.Rand, size int) reflect.Value {
+				return reflect.ValueOf(Even(2 * r.Uint32()))
+			})
+			Expect(surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: 1})).To(Succeed())
+		})
+
+		It("should prefer it to quick.Generator", func() {
+			surgeutil.RegisterGenerator(reflect.TypeOf(Odd(0)), func(r *rand.Rand, size int) reflect.Value {
+				return reflect.ValueOf(Odd(2))
+			})
+			x := generate(reflect.TypeOf(Odd(0)), rand.New(rand.NewSource(6)), surgeutil.Options{})
+			Expect(x).To(Equal(Odd(2)))
+		})
+	})
+
+	Context("when generating with the same seed", func() {
+		It("should generate the same value", func() {
+			x := generate(reflect.TypeOf(Record{}), rand.New(rand.NewSource(7)), surgeutil.Options{})
+			y := generate(reflect.TypeOf(Record{}), rand.New(rand.NewSource(7)), surgeutil.Options{})
+			Expect(x).To(Equal(y))
+		})
+	})
+
+	Context("when a type cannot be generated", func() {
+		It("should return an error", func() {
+			_, err := surgeutil.Generate(reflect.TypeOf(make(chan int)), rand.New(rand.NewSource(8)), surgeutil.Options{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
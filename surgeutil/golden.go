@@ -0,0 +1,242 @@
+package surgeutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/renproject/surge"
+)
+
+// DefaultGoldenSeed is the seed used to generate the values stored in golden
+// files, unless the options say otherwise. Unlike other checks, golden checks
+// never use a random seed, because the same values must be generated every
+// time.
+const DefaultGoldenSeed = 1
+
+// DefaultGoldenValues is the number of values stored in golden files, unless
+// the options say otherwise.
+const DefaultGoldenValues = 10
+
+var updateGolden = flag.Bool("surgeutil.update", false, "regenerate surgeutil golden files")
+
+// GoldenCheck protects the binary representation of a type against accidental
+// changes. The golden file "testdata/<name>.golden" stores the schema of the
+// type, and the binary representations of random instances of the type. The
+// stored binary representations are the source of truth: they are unmarshaled,
+// and marshaled again, using the current version of the type. An error is
+// returned when:
+//
+//  - the golden file does not exist,
+//  - the schema of the type (the types and struct tags of its fields, but not
+//    their names) is different from the schema stored in the golden file, or
+//  - the stored binary representations cannot be unmarshaled, or are not
+//    reproduced exactly when the unmarshaled values are marshaled again.
+//
+// Golden files are created, or regenerated, by running the tests with the
+// -surgeutil.update flag. Random instances are generated using a fixed seed,
+// but the values that are generated can change between versions of surgeutil
+// (and when custom generators change). This is not an error, because the
+// stored binary representations are still checked, but a warning that the
+// golden file can be regenerated is reported using the Logf option. Otherwise,
+// it returns nil.
+//
+//  func TestBlockGolden(t *testing.T) {
+//      if err := surgeutil.GoldenCheck(reflect.TypeOf(Block{}), "block"); err != nil {
+//          t.Fatal(err)
+//      }
+//  }
+//
+func GoldenCheck(t reflect.Type, name string) error {
+	return GoldenCheckWithOptions(t, name, Options{})
+}
+
+// GoldenCheckWithOptions is the same as GoldenCheck, but uses the given
+// options. The seed is given by the Seed option (or DefaultGoldenSeed), the
+// number of values by the GoldenValues option, the directory of the golden file
+// by the GoldenDir option, and the golden file is regenerated when the
+// UpdateGolden option is set.
+func GoldenCheckWithOptions(t reflect.Type, name string, opts Options) error {
+	if opts.Seed == 0 {
+		opts.Seed = DefaultGoldenSeed
+	}
+	if opts.GoldenValues == 0 {
+		opts.GoldenValues = DefaultGoldenValues
+	}
+	if opts.GoldenDir == "" {
+		opts.GoldenDir = "testdata"
+	}
+	path := filepath.Join(opts.GoldenDir, name+".golden")
+
+	r, seed, err := newRand(opts)
+	if err != nil {
+		return err
+	}
+	golden := goldenFile{Type: t.String(), Schema: Schema(t), Seed: seed}
+	for i := 0; i < opts.GoldenValues; i++ {
+		x, err := Generate(t, r, opts)
+		if err != nil {
+			return err
+		}
+		data, err := surge.ToBinary(x.Interface())
+		if err != nil {
+			return NewErrCheckFailed(seed, x.Interface(), nil, fmt.Errorf("cannot marshal: %v", err))
+		}
+		golden.Data = append(golden.Data, data)
+	}
+
+	if opts.UpdateGolden || *updateGolden {
+		if err := os.MkdirAll(opts.GoldenDir, 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, golden.encode(), 0644)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read golden file (run with -surgeutil.update to create it): %v", err)
+	}
+	stored, err := decodeGoldenFile(contents)
+	if err != nil {
+		return fmt.Errorf("cannot read golden file %v: %v", path, err)
+	}
+	if stored.Schema != golden.Schema {
+		return fmt.Errorf("schema of %v has changed: expected %v, got %v (%v)", t, stored.Schema, golden.Schema, describeType(t, map[reflect.Type]bool{}))
+	}
+	for i, data := range stored.Data {
+		y := reflect.New(t)
+		if err := surge.FromBinary(y.Interface(), data); err != nil {
+			return NewErrCheckFailed(0, nil, data, fmt.Errorf("cannot unmarshal golden value %v: %v", i, err))
+		}
+		reencoded, err := surge.ToBinary(y.Elem().Interface())
+		if err != nil {
+			return NewErrCheckFailed(0, y.Elem().Interface(), data, fmt.Errorf("cannot marshal golden value %v: %v", i, err))
+		}
+		if offset := FirstDifference(data, reencoded); offset >= 0 {
+			return NewErrCheckFailed(0, y.Elem().Interface(), data, fmt.Errorf("golden value %v differs at offset %v after unmarshaling and marshaling: %x", i, offset, reencoded))
+		}
+	}
+	if opts.Logf != nil && !golden.sameData(stored) {
+		opts.Logf("golden file %v was not generated by this version of surgeutil with seed %v and %v values (its binary representations are still valid, but run with -surgeutil.update to regenerate it)", path, seed, opts.GoldenValues)
+	}
+	return nil
+}
+
+// Schema returns a fingerprint of the schema of a type: the kinds of its
+// values, the types and struct tags of its fields, and the types that have
+// custom implementations. Changes to the schema of a type, such as reordering
+// its fields, usually change its binary representation. The names of fields
+// are not part of the schema, because they are not part of the binary
+// representation.
+func Schema(t reflect.Type) string {
+	hash := sha256.Sum256([]byte(describeType(t, map[reflect.Type]bool{})))
+	return hex.EncodeToString(hash[:16])
+}
+
+// describeType returns a description of the schema of a type. Types that have
+// already been seen are described by name, so that recursive types can be
+// described.
+func describeType(t reflect.Type, seen map[reflect.Type]bool) string {
+	if seen[t] {
+		return t.String()
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	if surge.HasCustomImplementation(t) {
+		return fmt.Sprintf("custom(%v)", t)
+	}
+
+	switch t.Kind() {
+	case reflect.Array:
+		return fmt.Sprintf("[%v]%v", t.Len(), describeType(t.Elem(), seen))
+	case reflect.Slice:
+		return fmt.Sprintf("[]%v", describeType(t.Elem(), seen))
+	case reflect.Map:
+		return fmt.Sprintf("map[%v]%v", describeType(t.Key(), seen), describeType(t.Elem(), seen))
+	case reflect.Ptr:
+		return fmt.Sprintf("*%v", describeType(t.Elem(), seen))
+	case reflect.Struct:
+		fields := make([]string, t.NumField())
+		for i := range fields {
+			field := t.Field(i)
+			fields[i] = describeType(field.Type, seen)
+			if tag, ok := field.Tag.Lookup("surge"); ok {
+				fields[i] += fmt.Sprintf(" %q", tag)
+			}
+		}
+		return fmt.Sprintf("struct{%v}", strings.Join(fields, "; "))
+	}
+	return t.Kind().String()
+}
+
+// goldenFile stores the binary representations of generated values, one per
+// line in hex, after a header that describes how they were generated.
+type goldenFile struct {
+	Type   string
+	Schema string
+	Seed   int64
+	Data   [][]byte
+}
+
+func (golden goldenFile) encode() []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# Generated by surgeutil.GoldenCheck. Do not edit.\n")
+	fmt.Fprintf(buf, "type: %v\n", golden.Type)
+	fmt.Fprintf(buf, "schema: %v\n", golden.Schema)
+	fmt.Fprintf(buf, "seed: %v\n", golden.Seed)
+	for _, data := range golden.Data {
+		fmt.Fprintf(buf, "%x\n", data)
+	}
+	return buf.Bytes()
+}
+
+// sameData returns true if two golden files store the same binary
+// representations.
+func (golden goldenFile) sameData(other goldenFile) bool {
+	if len(golden.Data) != len(other.Data) {
+		return false
+	}
+	for i := range golden.Data {
+		if !bytes.Equal(golden.Data[i], other.Data[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeGoldenFile(contents []byte) (goldenFile, error) {
+	golden := goldenFile{}
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	scanner.Buffer(nil, surge.MaxBytes)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		var err error
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+		case strings.HasPrefix(text, "type: "):
+			golden.Type = strings.TrimPrefix(text, "type: ")
+		case strings.HasPrefix(text, "schema: "):
+			golden.Schema = strings.TrimPrefix(text, "schema: ")
+		case strings.HasPrefix(text, "seed: "):
+			_, err = fmt.Sscan(strings.TrimPrefix(text, "seed: "), &golden.Seed)
+		default:
+			var data []byte
+			if data, err = hex.DecodeString(text); err == nil {
+				golden.Data = append(golden.Data, data)
+			}
+		}
+		if err != nil {
+			return golden, fmt.Errorf("line %v: %v", line, err)
+		}
+	}
+	return golden, scanner.Err()
+}
@@ -0,0 +1,112 @@
+package surgeutil_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type Pair struct {
+	A uint64
+	B uint32
+}
+
+type SwappedPair struct {
+	B uint32
+	A uint64
+}
+
+type RenamedPair struct {
+	First  uint64
+	Second uint32
+}
+
+var _ = Describe("GoldenCheck", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "surgeutil")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Context("when the golden file is up to date", func() {
+		It("should succeed", func() {
+			Expect(surgeutil.GoldenCheck(reflect.TypeOf(Record{}), "record")).To(Succeed())
+		})
+	})
+
+	Context("when the golden file is regenerated", func() {
+		It("should succeed on later runs", func() {
+			t := reflect.TypeOf(Record{})
+			Expect(surgeutil.GoldenCheckWithOptions(t, "record", surgeutil.Options{GoldenDir: dir})).ToNot(Succeed())
+			Expect(surgeutil.GoldenCheckWithOptions(t, "record", surgeutil.Options{GoldenDir: dir, UpdateGolden: true})).To(Succeed())
+			Expect(surgeutil.GoldenCheckWithOptions(t, "record", surgeutil.Options{GoldenDir: dir})).To(Succeed())
+		})
+	})
+
+	Context("when the generated values are different from the golden file", func() {
+		It("should succeed, and warn that the golden file can be regenerated", func() {
+			t := reflect.TypeOf(Record{})
+			Expect(surgeutil.GoldenCheckWithOptions(t, "record", surgeutil.Options{GoldenDir: dir, UpdateGolden: true})).To(Succeed())
+			warnings := []string{}
+			logf := func(format string, args ...interface{}) {
+				warnings = append(warnings, fmt.Sprintf(format, args...))
+			}
+			Expect(surgeutil.GoldenCheckWithOptions(t, "record", surgeutil.Options{GoldenDir: dir, Logf: logf})).To(Succeed())
+			Expect(warnings).To(BeEmpty())
+			Expect(surgeutil.GoldenCheckWithOptions(t, "record", surgeutil.Options{GoldenDir: dir, Seed: 2, Logf: logf})).To(Succeed())
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0]).To(ContainSubstring("-surgeutil.update"))
+			Expect(surgeutil.GoldenCheckWithOptions(t, "record", surgeutil.Options{GoldenDir: dir, GoldenValues: 3, Logf: logf})).To(Succeed())
+			Expect(warnings).To(HaveLen(2))
+		})
+	})
+
+	Context("when a field is renamed", func() {
+		It("should succeed", func() {
+			Expect(surgeutil.GoldenCheckWithOptions(reflect.TypeOf(Pair{}), "pair", surgeutil.Options{GoldenDir: dir, UpdateGolden: true})).To(Succeed())
+			Expect(surgeutil.GoldenCheckWithOptions(reflect.TypeOf(RenamedPair{}), "pair", surgeutil.Options{GoldenDir: dir})).To(Succeed())
+			Expect(surgeutil.Schema(reflect.TypeOf(Pair{}))).To(Equal(surgeutil.Schema(reflect.TypeOf(RenamedPair{}))))
+		})
+	})
+
+	Context("when the schema of the type changes", func() {
+		It("should return an error", func() {
+			Expect(surgeutil.GoldenCheckWithOptions(reflect.TypeOf(Pair{}), "pair", surgeutil.Options{GoldenDir: dir, UpdateGolden: true})).To(Succeed())
+			err := surgeutil.GoldenCheckWithOptions(reflect.TypeOf(SwappedPair{}), "pair", surgeutil.Options{GoldenDir: dir})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("schema"))
+			Expect(surgeutil.Schema(reflect.TypeOf(Pair{}))).ToNot(Equal(surgeutil.Schema(reflect.TypeOf(SwappedPair{}))))
+		})
+	})
+
+	Context("when the golden bytes are not reproduced", func() {
+		It("should return an error", func() {
+			t := reflect.TypeOf(Pair{})
+			Expect(surgeutil.GoldenCheckWithOptions(t, "pair", surgeutil.Options{GoldenDir: dir, UpdateGolden: true})).To(Succeed())
+			path := filepath.Join(dir, "pair.golden")
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			lines := strings.Split(string(contents), "\n")
+			lines[4] += "00"
+			Expect(ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)).To(Succeed())
+
+			err = surgeutil.GoldenCheckWithOptions(t, "pair", surgeutil.Options{GoldenDir: dir})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("differs at offset 12"))
+		})
+	})
+})
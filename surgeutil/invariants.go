@@ -0,0 +1,159 @@
+package surgeutil
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/renproject/surge"
+)
+
+// InvariantCheck generates a random instance of a type, and then marshals and
+// unmarshals it with every buffer size, and every remaining memory quota, that
+// is too small. It checks the invariants that custom implementations must
+// respect, even when they return errors:
+//
+//   - errors caused by a buffer, or remaining memory quota, that is too small
+//     are ErrUnexpectedEndOfBuffer or ErrLengthOverflow,
+//   - the returned tail is a suffix of the buffer,
+//   - the returned remaining memory quota is never negative, and never greater
+//     than the remaining memory quota that was given,
+//   - marshaling and unmarshaling consume exactly the number of bytes predicted
+//     by SizeHint, and
+//   - marshaling and unmarshaling do not panic.
+//
+// An error is returned when an invariant does not hold. Otherwise, it returns
+// nil.
+func InvariantCheck(t reflect.Type) error {
+	return InvariantCheckWithOptions(t, Options{})
+}
+
+// InvariantCheckWithOptions is the same as InvariantCheck, but uses the given
+// options. The number of buffer sizes, and remaining memory quotas, that are
+// tested is given by the Steps option. When the check fails, an ErrCheckFailed
+// is returned for the smallest value that fails.
+func InvariantCheckWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, invariants)
+}
+
+func invariants(x reflect.Value, opts Options) error {
+	v := x.Interface()
+	size := surge.SizeHint(v)
+
+	// Marshal
+	marshal := func(buf []byte, rem int) func() ([]byte, int, error) {
+		return func() ([]byte, int, error) { return surge.Marshal(v, buf, rem) }
+	}
+	data := make([]byte, size)
+	tail, rem, err := call(marshal(data, surge.MaxBytes))
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if err := checkResult(data, surge.MaxBytes, tail, rem); err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if consumed := size - len(tail); consumed != size {
+		return fmt.Errorf("marshal consumed %v bytes, but SizeHint predicted %v bytes", consumed, size)
+	}
+	step := stepSize(size, opts.Steps)
+	for n := 0; n < size; n += step {
+		buf := make([]byte, n)
+		if err := checkTooSmall(buf, surge.MaxBytes, marshal(buf, surge.MaxBytes)); err != nil {
+			return fmt.Errorf("marshal with a buffer of %v bytes: %w", n, err)
+		}
+	}
+	// Marshaling can use more of the remaining memory quota than the number
+	// of bytes that it writes (for example, maps marshal their keys into
+	// temporary buffers so that they can be sorted), so all quotas below the
+	// amount that was actually used must fail.
+	required := surge.MaxBytes - rem
+	for n := 0; n < required; n += stepSize(required, opts.Steps) {
+		buf := make([]byte, size)
+		if err := checkTooSmall(buf, n, marshal(buf, n)); err != nil {
+			return fmt.Errorf("marshal with a memory quota of %v bytes: %w", n, err)
+		}
+	}
+
+	// Unmarshal
+	unmarshal := func(buf []byte, rem int) func() ([]byte, int, error) {
+		return func() ([]byte, int, error) { return surge.Unmarshal(reflect.New(x.Type()).Interface(), buf, rem) }
+	}
+	tail, rem, err = call(unmarshal(data, surge.MaxBytes))
+	if err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	if err := checkResult(data, surge.MaxBytes, tail, rem); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	if consumed := size - len(tail); consumed != size {
+		return fmt.Errorf("unmarshal consumed %v bytes, but SizeHint predicted %v bytes", consumed, size)
+	}
+	for n := 0; n < size; n += step {
+		if err := checkTooSmall(data[:n], surge.MaxBytes, unmarshal(data[:n], surge.MaxBytes)); err != nil {
+			return fmt.Errorf("unmarshal with a buffer of %v bytes: %w", n, err)
+		}
+	}
+	required = surge.MaxBytes - rem
+	for n := 0; n < required; n += stepSize(required, opts.Steps) {
+		if err := checkTooSmall(data, n, unmarshal(data, n)); err != nil {
+			return fmt.Errorf("unmarshal with a memory quota of %v bytes: %w", n, err)
+		}
+	}
+	return nil
+}
+
+// checkTooSmall calls a function with a buffer, or remaining memory quota,
+// that is too small, and checks that it returns the expected error, and a
+// tail and remaining memory quota that respect the invariants.
+func checkTooSmall(buf []byte, rem int, f func() ([]byte, int, error)) error {
+	tail, remOut, err := call(f)
+	if err := checkResult(buf, rem, tail, remOut); err != nil {
+		return err
+	}
+	switch {
+	case err == nil:
+		return fmt.Errorf("unexpected success")
+	case errors.As(err, &errPanicked{}):
+		return err
+	case !errors.Is(err, surge.ErrUnexpectedEndOfBuffer) && !errors.Is(err, surge.ErrLengthOverflow):
+		return fmt.Errorf("expected %q or %q, got %q", surge.ErrUnexpectedEndOfBuffer, surge.ErrLengthOverflow, err)
+	}
+	return nil
+}
+
+// checkResult checks that the tail, and remaining memory quota, returned from
+// marshaling or unmarshaling respect the invariants.
+func checkResult(buf []byte, rem int, tail []byte, remOut int) error {
+	if len(tail) > len(buf) {
+		return fmt.Errorf("tail of %v bytes is longer than the buffer of %v bytes", len(tail), len(buf))
+	}
+	if len(tail) > 0 && &tail[0] != &buf[len(buf)-len(tail)] {
+		return fmt.Errorf("tail of %v bytes is not a suffix of the buffer", len(tail))
+	}
+	if remOut < 0 {
+		return fmt.Errorf("negative remaining memory quota: %v", remOut)
+	}
+	if remOut > rem {
+		return fmt.Errorf("remaining memory quota increased from %v to %v", rem, remOut)
+	}
+	return nil
+}
+
+// errPanicked is returned by call when the function panics.
+type errPanicked struct {
+	p interface{}
+}
+
+func (err errPanicked) Error() string {
+	return fmt.Sprintf("panicked: %v", err.p)
+}
+
+// call a marshaling, or unmarshaling, function and recover from panics.
+func call(f func() ([]byte, int, error)) (tail []byte, rem int, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errPanicked{p}
+		}
+	}()
+	return f()
+}
@@ -0,0 +1,134 @@
+package surgeutil_test
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Vague is a custom implementation that returns its own error when the buffer
+// is too small.
+type Vague uint32
+
+func (Vague) SizeHint() int {
+	return surge.SizeHintU32
+}
+
+func (v Vague) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	if len(buf) < surge.SizeHintU32 || rem < surge.SizeHintU32 {
+		return buf, rem, errors.New("not enough space")
+	}
+	return surge.MarshalU32(uint32(v), buf, rem)
+}
+
+func (v *Vague) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.UnmarshalU32((*uint32)(v), buf, rem)
+}
+
+// Overdrawn is a custom implementation that subtracts from the remaining
+// memory quota before checking it.
+type Overdrawn uint32
+
+func (Overdrawn) SizeHint() int {
+	return surge.SizeHintU32
+}
+
+func (o Overdrawn) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	if rem -= surge.SizeHintU32; rem < 0 {
+		return buf, rem, surge.ErrUnexpectedEndOfBuffer
+	}
+	return surge.MarshalU32(uint32(o), buf, rem+surge.SizeHintU32)
+}
+
+func (o *Overdrawn) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.UnmarshalU32((*uint32)(o), buf, rem)
+}
+
+// Detached is a custom implementation that returns a copy of the buffer when
+// it is unmarshaled, instead of a suffix.
+type Detached uint32
+
+func (Detached) SizeHint() int {
+	return surge.SizeHintU32
+}
+
+func (d Detached) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU32(uint32(d), buf, rem)
+}
+
+func (d *Detached) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	tail, rem, err := surge.UnmarshalU32((*uint32)(d), buf, rem)
+	return append([]byte{}, tail...), rem, err
+}
+
+var _ = Describe("InvariantCheck", func() {
+	checkFailed := func(err error) surgeutil.ErrCheckFailed {
+		f := surgeutil.ErrCheckFailed{}
+		Expect(errors.As(err, &f)).To(BeTrue())
+		return f
+	}
+
+	Context("when the invariants hold", func() {
+		It("should succeed", func() {
+			for _, t := range []reflect.Type{
+				reflect.TypeOf(Record{}),
+				reflect.TypeOf(Tagged{}),
+				reflect.TypeOf(map[string][]uint16{}),
+				reflect.TypeOf(map[uint8]map[string]bool{}),
+				reflect.TypeOf([]Forgetful{}),
+				reflect.TypeOf([]Point{}),
+			} {
+				for trial := 0; trial < 10; trial++ {
+					Expect(surgeutil.InvariantCheckWithOptions(t, surgeutil.Options{Steps: 100})).To(Succeed())
+				}
+			}
+		})
+	})
+
+	Context("when the wrong error is returned", func() {
+		It("should return an error", func() {
+			err := surgeutil.InvariantCheckWithOptions(reflect.TypeOf(Vague(0)), surgeutil.Options{Seed: 1})
+			Expect(checkFailed(err).Error()).To(ContainSubstring("not enough space"))
+		})
+	})
+
+	Context("when the remaining memory quota becomes negative", func() {
+		It("should return an error", func() {
+			err := surgeutil.InvariantCheckWithOptions(reflect.TypeOf(Overdrawn(0)), surgeutil.Options{Seed: 1})
+			Expect(checkFailed(err).Error()).To(ContainSubstring("negative remaining memory quota"))
+		})
+	})
+
+	Context("when the tail is not a suffix of the buffer", func() {
+		It("should return an error", func() {
+			err := surgeutil.InvariantCheckWithOptions(reflect.TypeOf([]Detached{}), surgeutil.Options{Seed: 1})
+			Expect(checkFailed(err).Error()).To(ContainSubstring("not a suffix"))
+		})
+	})
+
+	Context("when unmarshaling consumes more than it should", func() {
+		It("should return an error", func() {
+			err := surgeutil.InvariantCheckWithOptions(reflect.TypeOf(Greedy{}), surgeutil.Options{Seed: 1})
+			Expect(checkFailed(err).Error()).To(ContainSubstring("unexpected success"))
+		})
+	})
+
+	Context("when the size hint is wrong", func() {
+		It("should return an error", func() {
+			err := surgeutil.InvariantCheckWithOptions(reflect.TypeOf(Overestimated(0)), surgeutil.Options{Seed: 1})
+			Expect(checkFailed(err).Error()).To(ContainSubstring("SizeHint predicted"))
+		})
+	})
+
+	Context("when unmarshaling panics", func() {
+		It("should return an error", func() {
+			err := surgeutil.InvariantCheckWithOptions(reflect.TypeOf(Careless(0)), surgeutil.Options{Seed: 1})
+			Expect(checkFailed(err).Error()).To(ContainSubstring("panicked"))
+		})
+	})
+})
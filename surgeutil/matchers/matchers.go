@@ -0,0 +1,279 @@
+// Package matchers provides gomega matchers for surge properties. Every matcher
+// accepts either a value, in which case the property is checked for that value,
+// or a reflect.Type, in which case the property is checked for a random
+// instance of that type using the surgeutil package.
+//
+//  Expect(msg).To(matchers.RoundTripSurge())
+//  Expect(msg).To(matchers.HaveSurgeEncoding("0000000100000003616263"))
+//  Expect(reflect.TypeOf(Message{})).To(matchers.RejectTruncation())
+package matchers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+)
+
+// HexDiffContext is the number of bytes shown either side of the first
+// difference in hex diffs.
+const HexDiffContext = 16
+
+// RoundTripSurge succeeds when marshaling a value, and unmarshaling the result,
+// gives back a deeply equal value.
+func RoundTripSurge() types.GomegaMatcher {
+	return &roundTripMatcher{}
+}
+
+// HaveSurgeEncoding succeeds when the binary representation of a value is equal
+// to the given hex string. Whitespace in the hex string is ignored, so long
+// binary representations can be split into readable chunks.
+func HaveSurgeEncoding(expected string) types.GomegaMatcher {
+	return &encodingMatcher{expected: expected}
+}
+
+// HaveAccurateSizeHint succeeds when the size hint of a value is equal to the
+// number of bytes written when marshaling it.
+func HaveAccurateSizeHint() types.GomegaMatcher {
+	return &sizeHintMatcher{}
+}
+
+// RejectTruncation succeeds when unmarshaling every truncation of the binary
+// representation of a value returns an error (and does not panic).
+func RejectTruncation() types.GomegaMatcher {
+	return &truncationMatcher{}
+}
+
+type roundTripMatcher struct {
+	reason string
+}
+
+func (matcher *roundTripMatcher) Match(actual interface{}) (bool, error) {
+	if t, ok := actual.(reflect.Type); ok {
+		return matcher.fail(surgeutil.MarshalUnmarshalCheck(t))
+	}
+	if actual == nil {
+		return false, fmt.Errorf("RoundTripSurge expects a value or a reflect.Type, got nil")
+	}
+	data, err := surge.ToBinary(actual)
+	if err != nil {
+		return matcher.fail(fmt.Errorf("cannot marshal: %v", err))
+	}
+	y := reflect.New(reflect.TypeOf(actual))
+	if err := unmarshal(y.Interface(), data, true); err != nil {
+		return matcher.fail(fmt.Errorf("cannot unmarshal %x: %v", data, err))
+	}
+	if !reflect.DeepEqual(actual, y.Elem().Interface()) {
+		reason := fmt.Sprintf("unmarshaled\n%s\n%s", format.Object(y.Elem().Interface(), 1), surgeutil.Diff(actual, y.Elem().Interface()))
+		if remarshaled, err := surgeutil.Encode(y.Elem().Interface()); err == nil && !bytes.Equal(data, remarshaled) {
+			reason += "\nwhich marshals differently:\n" + hexDiff(data, remarshaled)
+		}
+		return matcher.fail(fmt.Errorf("%s", reason))
+	}
+	return true, nil
+}
+
+func (matcher *roundTripMatcher) fail(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	matcher.reason = err.Error()
+	return false, nil
+}
+
+func (matcher *roundTripMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n%s\nto round-trip through surge, but\n%s", format.Object(actual, 1), format.IndentString(matcher.reason, 1))
+}
+
+func (matcher *roundTripMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n%s\nnot to round-trip through surge", format.Object(actual, 1))
+}
+
+type encodingMatcher struct {
+	expected string
+	reason   string
+}
+
+func (matcher *encodingMatcher) Match(actual interface{}) (bool, error) {
+	if _, ok := actual.(reflect.Type); ok {
+		return false, fmt.Errorf("HaveSurgeEncoding expects a value, got a reflect.Type")
+	}
+	if actual == nil {
+		return false, fmt.Errorf("HaveSurgeEncoding expects a value, got nil")
+	}
+	expected, err := hex.DecodeString(strings.Join(strings.Fields(matcher.expected), ""))
+	if err != nil {
+		return false, fmt.Errorf("HaveSurgeEncoding expects a hex string: %v", err)
+	}
+	data, err := surge.ToBinary(actual)
+	if err != nil {
+		matcher.reason = fmt.Sprintf("cannot marshal: %v", err)
+		return false, nil
+	}
+	if !bytes.Equal(expected, data) {
+		matcher.reason = hexDiff(expected, data)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (matcher *encodingMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n%s\nto have surge encoding\n%s\nbut\n%s", format.Object(actual, 1), format.IndentString(matcher.expected, 1), format.IndentString(matcher.reason, 1))
+}
+
+func (matcher *encodingMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n%s\nnot to have surge encoding\n%s", format.Object(actual, 1), format.IndentString(matcher.expected, 1))
+}
+
+type sizeHintMatcher struct {
+	reason string
+}
+
+func (matcher *sizeHintMatcher) Match(actual interface{}) (bool, error) {
+	if t, ok := actual.(reflect.Type); ok {
+		if err := surgeutil.SizeHintCheckWithOptions(t, surgeutil.Options{StrictSizeHint: true}); err != nil {
+			matcher.reason = err.Error()
+			return false, nil
+		}
+		return true, nil
+	}
+	if actual == nil {
+		return false, fmt.Errorf("HaveAccurateSizeHint expects a value or a reflect.Type, got nil")
+	}
+	sizeHint := surge.SizeHint(actual)
+	data, err := surgeutil.Encode(actual)
+	if err != nil {
+		matcher.reason = fmt.Sprintf("cannot marshal: %v", err)
+		return false, nil
+	}
+	if len(data) != sizeHint {
+		matcher.reason = fmt.Sprintf("hinted %v bytes, but wrote %v bytes:\n%x", sizeHint, len(data), data)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (matcher *sizeHintMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n%s\nto have an accurate size hint, but\n%s", format.Object(actual, 1), format.IndentString(matcher.reason, 1))
+}
+
+func (matcher *sizeHintMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n%s\nnot to have an accurate size hint", format.Object(actual, 1))
+}
+
+type truncationMatcher struct {
+	reason string
+}
+
+func (matcher *truncationMatcher) Match(actual interface{}) (bool, error) {
+	if t, ok := actual.(reflect.Type); ok {
+		if err := surgeutil.UnmarshalBufTooSmall(t); err != nil {
+			matcher.reason = err.Error()
+			return false, nil
+		}
+		return true, nil
+	}
+	if actual == nil {
+		return false, fmt.Errorf("RejectTruncation expects a value or a reflect.Type, got nil")
+	}
+	data, err := surge.ToBinary(actual)
+	if err != nil {
+		matcher.reason = fmt.Sprintf("cannot marshal: %v", err)
+		return false, nil
+	}
+	t := reflect.TypeOf(actual)
+	for n := 0; n < len(data); n++ {
+		err := unmarshal(reflect.New(t).Interface(), data[:n], false)
+		if _, ok := err.(panicked); ok {
+			matcher.reason = fmt.Sprintf("truncated to %v of %v bytes, %v:\n%x", n, len(data), err, data[:n])
+			return false, nil
+		}
+		if err == nil {
+			matcher.reason = fmt.Sprintf("truncated to %v of %v bytes, unmarshaling succeeded:\n%x", n, len(data), data[:n])
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (matcher *truncationMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n%s\nto reject truncation, but when\n%s", format.Object(actual, 1), format.IndentString(matcher.reason, 1))
+}
+
+func (matcher *truncationMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n%s\nnot to reject truncation", format.Object(actual, 1))
+}
+
+// panicked is returned by unmarshal when unmarshaling panics.
+type panicked struct {
+	p interface{}
+}
+
+func (p panicked) Error() string {
+	return fmt.Sprintf("unmarshaling panicked: %v", p.p)
+}
+
+// unmarshal bytes into a value, recovering from panics. When all bytes must be
+// consumed, FromBinary is used.
+func unmarshal(v interface{}, data []byte, all bool) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = panicked{p}
+		}
+	}()
+	if all {
+		return surge.FromBinary(v, data)
+	}
+	_, _, err = surge.Unmarshal(v, data, surge.MaxBytes)
+	return err
+}
+
+// hexDiff formats two binary representations as hex, around the offset of
+// their first difference, with a marker under the first differing byte.
+func hexDiff(expected, actual []byte) string {
+	offset := surgeutil.FirstDifference(expected, actual)
+	if offset < 0 {
+		return "no difference"
+	}
+	start := offset - HexDiffContext
+	if start < 0 {
+		start = 0
+	}
+	end := offset + HexDiffContext + 1
+	prefix := ""
+	if start > 0 {
+		prefix = "..."
+	}
+	marker := strings.Repeat(" ", len("expected: ")+len(prefix)+2*(offset-start)) + "^^"
+	return fmt.Sprintf(
+		"first difference at byte %v (expected %v bytes, got %v bytes)\nexpected: %s\nactual:   %s\n%s",
+		offset, len(expected), len(actual),
+		hexWindow(expected, start, end), hexWindow(actual, start, end),
+		marker,
+	)
+}
+
+// hexWindow formats bytes, between a start and an end offset, as hex. Ellipses
+// mark bytes that are not shown.
+func hexWindow(data []byte, start, end int) string {
+	if end > len(data) {
+		end = len(data)
+	}
+	if start > end {
+		start = end
+	}
+	s := hex.EncodeToString(data[start:end])
+	if start > 0 {
+		s = "..." + s
+	}
+	if end < len(data) {
+		s += "..."
+	}
+	return s
+}
@@ -0,0 +1,207 @@
+package matchers_test
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil/matchers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type Message struct {
+	Nonce   uint64
+	Payload string
+	Votes   map[string]bool
+}
+
+// Lossy is a custom implementation that loses its upper bits when it is
+// unmarshaled.
+type Lossy uint16
+
+func (l Lossy) SizeHint() int {
+	return surge.SizeHintU16
+}
+
+func (l Lossy) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU16(uint16(l), buf, rem)
+}
+
+func (l *Lossy) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.UnmarshalU16((*uint16)(l), buf, rem)
+	*l &= 0xFF
+	return buf, rem, err
+}
+
+// Padded is a custom implementation that hints at more bytes than it writes.
+type Padded uint32
+
+func (Padded) SizeHint() int {
+	return 8
+}
+
+func (p Padded) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU32(uint32(p), buf, rem)
+}
+
+func (p *Padded) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.UnmarshalU32((*uint32)(p), buf, rem)
+}
+
+// Lenient is a custom implementation that accepts truncated binary
+// representations.
+type Lenient uint32
+
+func (Lenient) SizeHint() int {
+	return surge.SizeHintU32
+}
+
+func (l Lenient) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU32(uint32(l), buf, rem)
+}
+
+func (l *Lenient) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	if len(buf) < surge.SizeHintU32 {
+		*l = 0
+		return buf[len(buf):], rem, nil
+	}
+	return surge.UnmarshalU32((*uint32)(l), buf, rem)
+}
+
+// Trusting is a custom implementation that does not check the length of the
+// buffer, and panics when it is truncated.
+type Trusting uint32
+
+func (Trusting) SizeHint() int {
+	return surge.SizeHintU32
+}
+
+func (t Trusting) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU32(uint32(t), buf, rem)
+}
+
+func (t *Trusting) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	*t = Trusting(binary.BigEndian.Uint32(buf))
+	return buf[4:], rem - 4, nil
+}
+
+var _ = Describe("Matchers", func() {
+	msg := Message{Nonce: 1, Payload: "abc", Votes: map[string]bool{"x": true}}
+
+	Context("when a value is well-behaved", func() {
+		It("should match", func() {
+			Expect(msg).To(matchers.RoundTripSurge())
+			Expect(msg).To(matchers.HaveSurgeEncoding("0000000000000001 00000003616263 00000001 0000000178 01"))
+			Expect(msg).To(matchers.HaveAccurateSizeHint())
+			Expect(msg).To(matchers.RejectTruncation())
+		})
+	})
+
+	Context("when a type is well-behaved", func() {
+		It("should match random instances", func() {
+			t := reflect.TypeOf(Message{})
+			Expect(t).To(matchers.RoundTripSurge())
+			Expect(t).To(matchers.HaveAccurateSizeHint())
+			Expect(t).To(matchers.RejectTruncation())
+		})
+	})
+
+	Context("when a value does not round-trip", func() {
+		It("should fail with the unmarshaled value and a hex diff", func() {
+			Expect(Lossy(0x1234)).ToNot(matchers.RoundTripSurge())
+			failures := InterceptGomegaFailures(func() {
+				Expect(Lossy(0x1234)).To(matchers.RoundTripSurge())
+			})
+			Expect(failures).To(HaveLen(1))
+			Expect(failures[0]).To(ContainSubstring("to round-trip through surge"))
+			Expect(failures[0]).To(ContainSubstring("value: expected 0x1234, got 0x34"))
+			Expect(failures[0]).To(ContainSubstring("first difference at byte 0"))
+			Expect(failures[0]).To(ContainSubstring("expected: 1234"))
+			Expect(failures[0]).To(ContainSubstring("actual:   0034"))
+		})
+	})
+
+	Context("when a value has a different encoding", func() {
+		It("should fail with a hex diff", func() {
+			Expect(msg).ToNot(matchers.HaveSurgeEncoding("0000000000000002"))
+			failures := InterceptGomegaFailures(func() {
+				Expect(uint64(1)).To(matchers.HaveSurgeEncoding("0000000000000002"))
+			})
+			Expect(failures).To(HaveLen(1))
+			Expect(failures[0]).To(ContainSubstring("first difference at byte 7"))
+			Expect(failures[0]).To(ContainSubstring("expected: 0000000000000002\n"))
+			Expect(failures[0]).To(ContainSubstring("actual:   0000000000000001\n"))
+			lines := strings.Split(failures[0], "\n")
+			for i, line := range lines {
+				if strings.Contains(line, "actual:") {
+					Expect(strings.Index(lines[i+1], "^^")).To(Equal(strings.LastIndex(line, "01")))
+				}
+			}
+		})
+
+		It("should only show the bytes around the first difference", func() {
+			expected := [64]byte{}
+			actual := [64]byte{}
+			actual[40] = 1
+			failures := InterceptGomegaFailures(func() {
+				Expect(actual).To(matchers.HaveSurgeEncoding(string(hexOf(expected[:]))))
+			})
+			Expect(failures).To(HaveLen(1))
+			Expect(failures[0]).To(ContainSubstring("first difference at byte 40"))
+			Expect(failures[0]).To(MatchRegexp(`actual:   \.\.\.0{32}010{32}\.\.\.`))
+		})
+
+		It("should return an error for invalid hex", func() {
+			_, err := matchers.HaveSurgeEncoding("xyz").Match(msg)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when the size hint is inaccurate", func() {
+		It("should fail", func() {
+			Expect(Padded(1)).ToNot(matchers.HaveAccurateSizeHint())
+			Expect(reflect.TypeOf(Padded(0))).ToNot(matchers.HaveAccurateSizeHint())
+			failures := InterceptGomegaFailures(func() {
+				Expect(Padded(1)).To(matchers.HaveAccurateSizeHint())
+			})
+			Expect(failures).To(HaveLen(1))
+			Expect(failures[0]).To(ContainSubstring("hinted 8 bytes, but wrote 4 bytes"))
+		})
+	})
+
+	Context("when truncation is accepted", func() {
+		It("should fail", func() {
+			Expect(Lenient(1)).ToNot(matchers.RejectTruncation())
+			Expect(reflect.TypeOf(Lenient(0))).ToNot(matchers.RejectTruncation())
+			failures := InterceptGomegaFailures(func() {
+				Expect(Lenient(1)).To(matchers.RejectTruncation())
+			})
+			Expect(failures).To(HaveLen(1))
+			Expect(failures[0]).To(ContainSubstring("truncated to 0 of 4 bytes, unmarshaling succeeded"))
+		})
+	})
+
+	Context("when unmarshaling a truncation panics", func() {
+		It("should fail", func() {
+			for _, actual := range []interface{}{Trusting(1), reflect.TypeOf(Trusting(0))} {
+				failures := InterceptGomegaFailures(func() {
+					Expect(actual).To(matchers.RejectTruncation())
+				})
+				Expect(failures).To(HaveLen(1))
+				Expect(failures[0]).To(ContainSubstring("panicked"))
+			}
+		})
+	})
+})
+
+func hexOf(data []byte) []byte {
+	const digits = "0123456789abcdef"
+	h := make([]byte, 0, 2*len(data))
+	for _, b := range data {
+		h = append(h, digits[b>>4], digits[b&0xF])
+	}
+	return h
+}
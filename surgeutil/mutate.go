@@ -0,0 +1,272 @@
+package surgeutil
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+
+	"github.com/renproject/surge"
+)
+
+// byteOrder of the length prefixes in the binary representations that are
+// mutated. Values are always marshaled using the default options, so this is
+// the default byte order (and not the byte order of any other Codec).
+var byteOrder = surge.DefaultOptions().ByteOrder
+
+// MutationFuzz generates random instances of a type, marshals them into
+// binary, and then mutates the binary representations using their structure:
+// flipping bits, inflating length prefixes to near the memory quota,
+// truncating, duplicating map entries, and swapping the order of map entries.
+// The mutated binary representations are unmarshaled, in normal and in strict
+// mode, with a memory quota of FuzzMaxBytes. An error is returned when
+// unmarshaling:
+//
+//  - panics,
+//  - returns a tail that is not a suffix, or a remaining memory quota that is
+//    negative or smaller than the number of bytes consumed,
+//  - allocates more than DefaultAllocFactor bytes per byte of memory quota
+//    (plus AllocSlack bytes), or
+//  - succeeds in strict mode, even though map entries were duplicated or
+//    swapped.
+//
+// The number of mutations is given by the iteration count. Otherwise, it
+// returns nil.
+func MutationFuzz(t reflect.Type, iterations int) error {
+	return MutationFuzzWithOptions(t, iterations, Options{})
+}
+
+// MutationFuzzWithOptions is the same as MutationFuzz, but uses the given
+// options. A new instance of the type is generated for every CorpusSize
+// mutations, and the maximum number of bytes allocated per byte of memory quota
+// is given by the AllocFactor option. When the check fails, an ErrCheckFailed
+// is returned that contains the generated value, and the mutated binary
+// representation.
+func MutationFuzzWithOptions(t reflect.Type, iterations int, opts Options) error {
+	r, seed, err := newRand(opts)
+	if err != nil {
+		return err
+	}
+	perValue := opts.CorpusSize
+	if perValue == 0 {
+		perValue = DefaultCorpusSize
+	}
+
+	var x reflect.Value
+	var data []byte
+	var lay layout
+	for i := 0; i < iterations; i++ {
+		if i%perValue == 0 {
+			if x, err = Generate(t, r, opts); err != nil {
+				return err
+			}
+			if data, err = surge.ToBinary(x.Interface()); err != nil {
+				return NewErrCheckFailed(seed, x.Interface(), nil, fmt.Errorf("cannot marshal: %v", err))
+			}
+			lay = layout{}
+			if _, err := lay.walk(t, data, 0); err != nil {
+				return NewErrCheckFailed(seed, x.Interface(), data, fmt.Errorf("cannot walk binary representation: %v", err))
+			}
+		}
+		mutated, mutation, nonCanonical := lay.mutate(data, r)
+		if err := mutationCheck(t, mutated, nonCanonical, allocFactor(opts)); err != nil {
+			return NewErrCheckFailed(seed, x.Interface(), mutated, fmt.Errorf("%v: %v", mutation, err))
+		}
+	}
+	return nil
+}
+
+// mutationCheck unmarshals mutated bytes in normal and strict mode.
+func mutationCheck(t reflect.Type, data []byte, nonCanonical bool, factor uint64) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("unmarshal panicked: %v", p)
+		}
+	}()
+
+	for _, strict := range []bool{false, true} {
+		codec := surge.NewCodec(surge.Options{MaxBytes: FuzzMaxBytes, Strict: strict})
+		x := reflect.New(t)
+		var tail []byte
+		var rem int
+		var unmarshalErr error
+		allocated := AllocatedBytes(func() {
+			tail, rem, unmarshalErr = codec.Unmarshal(x.Interface(), data, FuzzMaxBytes)
+		})
+		if allocated > factor*FuzzMaxBytes+AllocSlack {
+			return fmt.Errorf("allocated %v bytes with a memory quota of %v bytes", allocated, FuzzMaxBytes)
+		}
+		if unmarshalErr != nil {
+			continue
+		}
+		if strict && nonCanonical {
+			return fmt.Errorf("unexpected success in strict mode")
+		}
+		if len(tail) > len(data) || !bytes.Equal(tail, data[len(data)-len(tail):]) {
+			return fmt.Errorf("tail is not a suffix")
+		}
+		if rem < 0 {
+			return fmt.Errorf("negative remaining memory quota: %v", rem)
+		}
+		if consumed := len(data) - len(tail); FuzzMaxBytes-rem < consumed {
+			return fmt.Errorf("consumed %v bytes, but only %v bytes of memory quota", consumed, FuzzMaxBytes-rem)
+		}
+	}
+	return nil
+}
+
+// layout of a binary representation: the offsets of its length prefixes, and
+// of the entries of its maps.
+type layout struct {
+	prefixes []int
+	maps     []mapLayout
+}
+
+// mapLayout stores the offset of the length prefix of a map, and the offsets
+// of the start of each entry, followed by the offset of the end of the map.
+type mapLayout struct {
+	prefix  int
+	entries []int
+}
+
+// walk the binary representation of a value of the given type, starting at the
+// given offset, and record its layout. The offset of the end of the value is
+// returned. Values that have custom implementations are skipped.
+func (lay *layout) walk(t reflect.Type, data []byte, offset int) (int, error) {
+	if surge.HasCustomImplementation(t) {
+		tail, err := surge.Skip(t, data[offset:])
+		return len(data) - len(tail), err
+	}
+
+	var err error
+
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		if len(data) < offset+surge.SizeHintU32 {
+			return offset, surge.ErrUnexpectedEndOfBuffer
+		}
+		n := int(byteOrder.Uint32(data[offset:]))
+		lay.prefixes = append(lay.prefixes, offset)
+		prefix := offset
+		offset += surge.SizeHintU32
+
+		switch {
+		case t.Kind() == reflect.String || t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && !surge.HasCustomImplementation(t.Elem()):
+			if len(data) < offset+n {
+				return offset, surge.ErrUnexpectedEndOfBuffer
+			}
+			return offset + n, nil
+		case t.Kind() == reflect.Slice:
+			for i := 0; i < n; i++ {
+				if offset, err = lay.walk(t.Elem(), data, offset); err != nil {
+					return offset, err
+				}
+			}
+			return offset, nil
+		default:
+			m := mapLayout{prefix: prefix}
+			for i := 0; i < n; i++ {
+				m.entries = append(m.entries, offset)
+				if offset, err = lay.walk(t.Key(), data, offset); err != nil {
+					return offset, err
+				}
+				if offset, err = lay.walk(t.Elem(), data, offset); err != nil {
+					return offset, err
+				}
+			}
+			m.entries = append(m.entries, offset)
+			lay.maps = append(lay.maps, m)
+			return offset, nil
+		}
+
+	case reflect.Array:
+		for i := 0; i < t.Len(); i++ {
+			if offset, err = lay.walk(t.Elem(), data, offset); err != nil {
+				return offset, err
+			}
+		}
+		return offset, nil
+
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			tag, err := surge.FieldTag(t.Field(i))
+			if err != nil {
+				return offset, err
+			}
+			if n := tag.Fixed; n > 0 {
+				if len(data) < offset+n {
+					return offset, surge.ErrUnexpectedEndOfBuffer
+				}
+				offset += n
+				continue
+			}
+			if offset, err = lay.walk(t.Field(i).Type, data, offset); err != nil {
+				return offset, err
+			}
+		}
+		return offset, nil
+	}
+
+	tail, err := surge.Skip(t, data[offset:])
+	return len(data) - len(tail), err
+}
+
+// mutate returns a mutated copy of a binary representation, a description of
+// the mutation, and whether or not the mutation is guaranteed to make the
+// binary representation non-canonical.
+func (lay *layout) mutate(data []byte, r *rand.Rand) ([]byte, string, bool) {
+	mutated := append([]byte{}, data...)
+	switch r.Intn(5) {
+	case 0:
+		if len(lay.prefixes) > 0 {
+			prefix := lay.prefixes[r.Intn(len(lay.prefixes))]
+			lengths := inflatedLengths(byteOrder.Uint32(data[prefix:]), r)
+			n := lengths[r.Intn(len(lengths))]
+			byteOrder.PutUint32(mutated[prefix:], n)
+			return mutated, fmt.Sprintf("inflated length prefix at offset %v to %v", prefix, n), false
+		}
+	case 1:
+		if len(data) > 0 {
+			n := r.Intn(len(data))
+			return mutated[:n], fmt.Sprintf("truncated to %v bytes", n), false
+		}
+	case 2:
+		if m, ok := lay.randomMap(r, 1); ok {
+			i := r.Intn(len(m.entries) - 1)
+			entry := data[m.entries[i]:m.entries[i+1]]
+			mutated = append(append(append([]byte{}, data[:m.entries[i+1]]...), entry...), data[m.entries[i+1]:]...)
+			byteOrder.PutUint32(mutated[m.prefix:], uint32(len(m.entries)))
+			return mutated, fmt.Sprintf("duplicated map entry at offset %v", m.entries[i]), true
+		}
+	case 3:
+		if m, ok := lay.randomMap(r, 2); ok {
+			i := r.Intn(len(m.entries) - 2)
+			first, second := data[m.entries[i]:m.entries[i+1]], data[m.entries[i+1]:m.entries[i+2]]
+			copy(mutated[m.entries[i]:], second)
+			copy(mutated[m.entries[i]+len(second):], first)
+			return mutated, fmt.Sprintf("swapped map entries at offset %v", m.entries[i]), true
+		}
+	}
+	if len(data) == 0 {
+		return mutated, "no mutation", false
+	}
+	i := r.Intn(len(data))
+	bit := byte(1) << r.Intn(8)
+	mutated[i] ^= bit
+	return mutated, fmt.Sprintf("flipped bit %v at offset %v", bit, i), false
+}
+
+// randomMap returns a random map that has at least the given number of
+// entries.
+func (lay *layout) randomMap(r *rand.Rand, minEntries int) (mapLayout, bool) {
+	candidates := []mapLayout{}
+	for _, m := range lay.maps {
+		if len(m.entries)-1 >= minEntries {
+			candidates = append(candidates, m)
+		}
+	}
+	if len(candidates) == 0 {
+		return mapLayout{}, false
+	}
+	return candidates[r.Intn(len(candidates))], true
+}
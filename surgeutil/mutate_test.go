@@ -0,0 +1,95 @@
+package surgeutil_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type Tagged struct {
+	Hash  []byte `surge:"fixed=8"`
+	Name  string `surge:"maxlen=32"`
+	Votes map[string]uint8
+}
+
+// Careless is a custom implementation that does not check the length of the
+// buffer when it is unmarshaled.
+type Careless uint32
+
+func (Careless) SizeHint() int {
+	return surge.SizeHintU32
+}
+
+func (c Careless) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU32(uint32(c), buf, rem)
+}
+
+func (c *Careless) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	*c = Careless(binary.BigEndian.Uint32(buf))
+	return buf[4:], rem - 4, nil
+}
+
+// Hungry is a custom implementation that allocates before checking its length
+// prefix against the buffer, and the remaining memory quota.
+type Hungry []byte
+
+func (h Hungry) SizeHint() int {
+	return surge.SizeHintBytes([]byte(h))
+}
+
+func (h Hungry) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalBytes([]byte(h), buf, rem)
+}
+
+func (h *Hungry) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	if len(buf) < 4 {
+		return buf, rem, surge.ErrUnexpectedEndOfBuffer
+	}
+	*h = make(Hungry, binary.BigEndian.Uint32(buf))
+	if len(buf) < 4+len(*h) {
+		return buf, rem, surge.ErrUnexpectedEndOfBuffer
+	}
+	copy(*h, buf[4:])
+	return buf[4+len(*h):], rem - 4 - len(*h), nil
+}
+
+var _ = Describe("MutationFuzz", func() {
+	Context("when unmarshaling is robust", func() {
+		It("should succeed", func() {
+			for _, t := range []reflect.Type{
+				reflect.TypeOf(Record{}),
+				reflect.TypeOf(Tagged{}),
+				reflect.TypeOf(map[string][]uint16{}),
+				reflect.TypeOf(map[uint8]map[string]bool{}),
+				reflect.TypeOf([][]byte{}),
+				reflect.TypeOf([]Forgetful{}),
+			} {
+				Expect(surgeutil.MutationFuzz(t, 1000)).To(Succeed())
+			}
+		})
+	})
+
+	Context("when unmarshaling panics", func() {
+		It("should return an error", func() {
+			err := surgeutil.MutationFuzzWithOptions(reflect.TypeOf(Careless(0)), 100, surgeutil.Options{Seed: 1})
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Error()).To(ContainSubstring("panicked"))
+		})
+	})
+
+	Context("when unmarshaling allocates too much", func() {
+		It("should return an error", func() {
+			err := surgeutil.MutationFuzzWithOptions(reflect.TypeOf(Hungry{}), 1000, surgeutil.Options{Seed: 1})
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Error()).To(ContainSubstring("allocated"))
+		})
+	})
+})
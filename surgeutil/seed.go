@@ -0,0 +1,127 @@
+package surgeutil
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SeedEnv is the environment variable that can be used to replay the random
+// values generated by a failed check. When it is set, checks that do not have
+// an explicit seed will use it instead of the current time.
+//
+//  SURGEUTIL_SEED=1612345678 go test ./...
+//
+const SeedEnv = "SURGEUTIL_SEED"
+
+// Options for the checks in this package.
+type Options struct {
+	// Seed for generating random values. A value of 0 means that the seed is
+	// read from the SeedEnv environment variable or, if it is not set, from
+	// the current time.
+	Seed int64
+	// Iterations is the number of random values that CheckAll checks, for
+	// each check. A value of 0 means that DefaultIterations is used.
+	Iterations int
+	// MaxSize is the maximum length of generated strings, slices, and maps. A
+	// value of 0 means that DefaultMaxSize is used.
+	MaxSize int
+	// MaxDepth is the maximum depth of generated values. A value of 0 means
+	// that DefaultMaxDepth is used.
+	MaxDepth int
+	// Steps is the number of buffer sizes, or memory quotas, that are tested.
+	// A value of 0 means that all of them will be tested.
+	Steps int
+	// MaxShrinks is the maximum number of smaller values that are tried when
+	// shrinking a value that fails a check. A value of 0 means that
+	// DefaultMaxShrinks is used, and a negative value disables shrinking.
+	MaxShrinks int
+	// CorpusSize is the number of random values that are added to the seed
+	// corpus of a fuzz test. A value of 0 means that DefaultCorpusSize is used.
+	CorpusSize int
+	// Repeats is the number of times that a value is marshaled by checks that
+	// marshal repeatedly. A value of 0 means that DefaultRepeats is used.
+	Repeats int
+	// Goroutines is the number of goroutines that marshal a value
+	// simultaneously in ConcurrencyCheck. A value of 0 means that
+	// DefaultGoroutines is used.
+	Goroutines int
+	// StrictSizeHint makes checks report size hints that over-estimate the
+	// number of bytes required as errors, instead of warnings.
+	StrictSizeHint bool
+	// GoldenValues is the number of values stored in golden files. A value of 0
+	// means that DefaultGoldenValues is used.
+	GoldenValues int
+	// GoldenDir is the directory in which golden files are stored. An empty
+	// value means that "testdata" is used.
+	GoldenDir string
+	// AllocFactor is the maximum number of bytes that unmarshaling is allowed
+	// to allocate, per byte of memory quota. A value of 0 means that
+	// DefaultAllocFactor is used.
+	AllocFactor int
+	// Compare makes BenchmarkMarshal and BenchmarkUnmarshal also benchmark
+	// encoding/json and encoding/gob, as sub-benchmarks.
+	Compare bool
+	// UpdateGolden regenerates golden files, instead of checking them. Golden
+	// files are also regenerated when the -surgeutil.update flag is set.
+	UpdateGolden bool
+	// Logf is used to report warnings. When it is nil, warnings are not
+	// reported.
+	Logf func(format string, args ...interface{})
+}
+
+// ErrCheckFailed is returned when a check fails. It contains everything that is
+// needed to reproduce the failure: the seed (or 0, when the value was not
+// randomly generated), the generated value (shrunk to the smallest value that
+// still fails), and its binary representation (when it is known).
+type ErrCheckFailed struct {
+	Seed  int64
+	Value interface{}
+	Data  []byte
+	Err   error
+}
+
+// NewErrCheckFailed constructs a new check failed error for the given seed,
+// value, binary representation, and cause.
+func NewErrCheckFailed(seed int64, value interface{}, data []byte, err error) error {
+	return ErrCheckFailed{Seed: seed, Value: value, Data: data, Err: err}
+}
+
+// Error implements the error interface.
+func (err ErrCheckFailed) Error() string {
+	if err.Seed == 0 {
+		return fmt.Sprintf("%v\n  value: %#v\n  data:  %x", err.Err, err.Value, err.Data)
+	}
+	return fmt.Sprintf("%v (replay with %v=%v)\n  value: %#v\n  data:  %x", err.Err, SeedEnv, err.Seed, err.Value, err.Data)
+}
+
+// Unwrap returns the cause of the failure.
+func (err ErrCheckFailed) Unwrap() error {
+	return err.Err
+}
+
+// newRand returns a random number generator, and the seed that was used to
+// create it.
+func newRand(opts Options) (*rand.Rand, int64, error) {
+	seed, err := resolveSeed(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rand.New(rand.NewSource(seed)), seed, nil
+}
+
+func resolveSeed(opts Options) (int64, error) {
+	if opts.Seed != 0 {
+		return opts.Seed, nil
+	}
+	if str, ok := os.LookupEnv(SeedEnv); ok && str != "" {
+		seed, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %v: %v", SeedEnv, err)
+		}
+		return seed, nil
+	}
+	return time.Now().UnixNano(), nil
+}
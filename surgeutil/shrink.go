@@ -0,0 +1,257 @@
+package surgeutil
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/renproject/surge"
+)
+
+// DefaultMaxShrinks is the maximum number of smaller values that are tried
+// when shrinking a value, unless the options say otherwise.
+const DefaultMaxShrinks = 10000
+
+// Shrink a value while it continues to fail. Slices are truncated, map entries
+// are dropped, strings are shortened, and scalars are zeroed (and halved),
+// recursively, until no smaller value fails or the maximum number of tries has
+// been reached. Struct fields with a fixed length tag keep their length. The
+// smallest value that fails is returned. A maximum of 0 means that
+// DefaultMaxShrinks is used, and a negative maximum disables shrinking.
+//
+//  minimal := surgeutil.Shrink(x, func(x interface{}) bool {
+//      data, err := surge.ToBinary(x)
+//      return err != nil || len(data) > 1024
+//  }, 0)
+//
+func Shrink(v interface{}, fails func(interface{}) bool, max int) interface{} {
+	return shrink(reflect.ValueOf(v), func(v reflect.Value) bool { return fails(v.Interface()) }, max).Interface()
+}
+
+func shrink(v reflect.Value, fails func(reflect.Value) bool, max int) reflect.Value {
+	if max == 0 {
+		max = DefaultMaxShrinks
+	}
+	for max > 0 {
+		shrunk := eachSmaller(v, surge.Tag{}, func(smaller reflect.Value) bool {
+			max--
+			if fails(smaller) {
+				v = smaller
+				return true
+			}
+			return max <= 0
+		})
+		if !shrunk {
+			break
+		}
+	}
+	return v
+}
+
+// sameCause returns true if a failure has the same cause as another failure,
+// so that shrinking does not turn one failure into a different one (for
+// example, a value that is unequal after a round-trip into a value that cannot
+// be marshaled at all).
+func sameCause(err, other error) bool {
+	return other != nil && failureClass(err) == failureClass(other)
+}
+
+// failureClass identifies the cause of a failure, without its details. It is
+// built from the messages of the error, and of the errors that it wraps, each
+// truncated at its first colon and stripped of digits, so that the same
+// failure at a different offset (or with a different length) has the same
+// class.
+func failureClass(err error) string {
+	class := []string{}
+	for ; err != nil; err = errors.Unwrap(err) {
+		msg := err.Error()
+		if i := strings.IndexByte(msg, ':'); i >= 0 {
+			msg = msg[:i]
+		}
+		class = append(class, strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return -1
+			}
+			return r
+		}, msg))
+	}
+	return strings.Join(class, ": ")
+}
+
+// eachSmaller calls the yield function for values that are smaller than the
+// given value, starting with the smallest, until the yield function returns
+// true. It returns true if the yield function returned true. The tag is the
+// struct tag of the value, if it is a struct field: values with a fixed length
+// keep their length (and no value is lengthened, so maximum lengths are kept).
+func eachSmaller(v reflect.Value, tag surge.Tag, yield func(reflect.Value) bool) bool {
+	t := v.Type()
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool() && yield(reflect.Zero(t))
+
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x := v.Uint()
+		return x != 0 && (yield(reflect.Zero(t)) || (x/2 != 0 && yield(reflect.ValueOf(x/2).Convert(t))))
+
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x := v.Int()
+		return x != 0 && (yield(reflect.Zero(t)) || (x/2 != 0 && yield(reflect.ValueOf(x/2).Convert(t))))
+
+	case reflect.Float32, reflect.Float64:
+		x := v.Float()
+		if x == 0 {
+			return false
+		}
+		if yield(reflect.Zero(t)) {
+			return true
+		}
+		if trunc := math.Trunc(x); !math.IsNaN(x) && !math.IsInf(x, 0) && trunc != x {
+			return yield(reflect.ValueOf(trunc).Convert(t))
+		}
+		return false
+
+	case reflect.String:
+		s := v.String()
+		if len(s) == 0 || tag.Fixed > 0 {
+			return false
+		}
+		if yield(reflect.Zero(t)) {
+			return true
+		}
+		if len(s) > 1 && yield(reflect.ValueOf(s[:len(s)/2]).Convert(t)) {
+			return true
+		}
+		return len(s) > 2 && yield(reflect.ValueOf(s[:len(s)-1]).Convert(t))
+
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if eachSmallerElem(v, i, yield) {
+				return true
+			}
+		}
+		return false
+
+	case reflect.Slice:
+		n := v.Len()
+		if n == 0 {
+			return false
+		}
+		if tag.Fixed == 0 {
+			// Empty slices are used instead of nil slices, because nil
+			// slices are unmarshaled as empty slices.
+			if yield(reflect.MakeSlice(t, 0, 0)) {
+				return true
+			}
+			if n > 1 && yield(copySlice(v, 0, n/2)) {
+				return true
+			}
+			for i := 0; i < n; i++ {
+				without := reflect.AppendSlice(copySlice(v, 0, i), v.Slice(i+1, n))
+				if yield(without) {
+					return true
+				}
+			}
+		}
+		for i := 0; i < n; i++ {
+			if eachSmallerElem(v, i, yield) {
+				return true
+			}
+		}
+		return false
+
+	case reflect.Map:
+		if v.Len() == 0 {
+			return false
+		}
+		if yield(reflect.MakeMap(t)) {
+			return true
+		}
+		keys := sortedKeys(v)
+		for _, k := range keys {
+			without := copyMap(v)
+			without.SetMapIndex(k, reflect.Value{})
+			if yield(without) {
+				return true
+			}
+		}
+		for _, k := range keys {
+			if eachSmaller(v.MapIndex(k), surge.Tag{}, func(smaller reflect.Value) bool {
+				m := copyMap(v)
+				m.SetMapIndex(k, smaller)
+				return yield(m)
+			}) {
+				return true
+			}
+		}
+		return false
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			// Unexported fields cannot be set, so they are not shrunk.
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			i := i
+			// The value was marshaled before it was shrunk, so its struct
+			// tags are valid.
+			tag, _ := surge.FieldTag(t.Field(i))
+			if eachSmaller(v.Field(i), tag, func(smaller reflect.Value) bool {
+				s := reflect.New(t).Elem()
+				s.Set(v)
+				s.Field(i).Set(smaller)
+				return yield(s)
+			}) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return false
+}
+
+// eachSmallerElem calls the yield function for copies of an array, or slice,
+// in which one element has been replaced by a smaller value.
+func eachSmallerElem(v reflect.Value, i int, yield func(reflect.Value) bool) bool {
+	return eachSmaller(v.Index(i), surge.Tag{}, func(smaller reflect.Value) bool {
+		var c reflect.Value
+		if v.Kind() == reflect.Array {
+			c = reflect.New(v.Type()).Elem()
+			c.Set(v)
+		} else {
+			c = copySlice(v, 0, v.Len())
+		}
+		c.Index(i).Set(smaller)
+		return yield(c)
+	})
+}
+
+func copySlice(v reflect.Value, i, j int) reflect.Value {
+	c := reflect.MakeSlice(v.Type(), j-i, j-i)
+	reflect.Copy(c, v.Slice(i, j))
+	return c
+}
+
+func copyMap(v reflect.Value) reflect.Value {
+	c := reflect.MakeMapWithSize(v.Type(), v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		c.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return c
+}
+
+// sortedKeys returns the keys of a map in a deterministic order, so that
+// shrinking is reproducible.
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
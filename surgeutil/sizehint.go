@@ -0,0 +1,113 @@
+package surgeutil
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/renproject/surge"
+)
+
+// SizeHintCheck generates a random instance of a type, and then compares its
+// size hint with the number of bytes written when marshaling it. An error is
+// returned when the size hint under-estimates the number of bytes written,
+// because this causes ToBinary to fail. A size hint that over-estimates the
+// number of bytes written is reported as a warning, because this leaves
+// trailing bytes after the binary representation. Otherwise, it returns nil.
+func SizeHintCheck(t reflect.Type) error {
+	return SizeHintCheckWithOptions(t, Options{})
+}
+
+// SizeHintCheckWithOptions is the same as SizeHintCheck, but uses the given
+// options. Over-estimates are reported using the Logf option, or as errors when
+// the StrictSizeHint option is set. When the check fails, an ErrCheckFailed is
+// returned for the smallest value that fails.
+func SizeHintCheckWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, sizeHintAccuracy)
+}
+
+func sizeHintAccuracy(x reflect.Value, opts Options) error {
+	sizeHint := surge.SizeHint(x.Interface())
+	written, err := bytesWritten(x.Interface(), sizeHint)
+	if err != nil {
+		return fmt.Errorf("cannot marshal: %w", err)
+	}
+	switch {
+	case written > sizeHint:
+		return fmt.Errorf("size hint under-estimates by %v bytes: hinted %v, wrote %v", written-sizeHint, sizeHint, written)
+	case written < sizeHint && opts.StrictSizeHint:
+		return fmt.Errorf("size hint over-estimates by %v bytes: hinted %v, wrote %v", sizeHint-written, sizeHint, written)
+	case written < sizeHint && opts.Logf != nil:
+		opts.Logf("size hint of %T over-estimates by %v bytes: hinted %v, wrote %v", x.Interface(), sizeHint-written, sizeHint, written)
+	}
+	return nil
+}
+
+// bytesWritten returns the number of bytes written when marshaling a value.
+func bytesWritten(v interface{}, sizeHint int) (int, error) {
+	data, err := encode(v, sizeHint)
+	return len(data), err
+}
+
+// Encode marshals a value into binary, even when its size hint is inaccurate
+// (in which case ToBinary fails). The buffer starts at the size hint, and is
+// doubled until marshaling succeeds. Panics are recovered, and returned as
+// errors.
+//
+//  data, err := surgeutil.Encode(x)
+//  if err != nil {
+//      panic(err)
+//  }
+//
+func Encode(v interface{}) ([]byte, error) {
+	return encode(v, surge.SizeHint(v))
+}
+
+// maxOutOfRangeRetries is the maximum number of times that encode doubles the
+// buffer after marshaling panics with an index, or slice, out of range.
+const maxOutOfRangeRetries = 8
+
+// encode marshals a value into binary, even when its size hint is inaccurate.
+// The buffer starts at the size hint, and is doubled until marshaling
+// succeeds. Custom implementations that trust their size hint might panic when
+// the buffer is too small, so panics with an index, or slice, out of range are
+// also retried, but only a limited number of times, because the panic might
+// have nothing to do with the buffer. Other panics are returned as errors.
+func encode(v interface{}, sizeHint int) ([]byte, error) {
+	n := sizeHint
+	retries := 0
+	for {
+		buf := make([]byte, n)
+		tail, _, err := call(func() ([]byte, int, error) {
+			return surge.Marshal(v, buf, surge.MaxBytes)
+		})
+		if err == nil {
+			return buf[:n-len(tail)], nil
+		}
+		if outOfRange(err) && retries < maxOutOfRangeRetries {
+			retries++
+		} else if err != surge.ErrUnexpectedEndOfBuffer {
+			return nil, err
+		}
+		if n >= surge.MaxBytes {
+			return nil, err
+		}
+		n = 2*n + 1
+		if n > surge.MaxBytes {
+			n = surge.MaxBytes
+		}
+	}
+}
+
+// outOfRange returns true if an error is a panic caused by indexing, or
+// slicing, out of range.
+func outOfRange(err error) bool {
+	p := errPanicked{}
+	if !errors.As(err, &p) {
+		return false
+	}
+	runtimeErr, ok := p.p.(runtime.Error)
+	return ok && strings.Contains(runtimeErr.Error(), "out of range")
+}
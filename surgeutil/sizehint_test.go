@@ -0,0 +1,140 @@
+package surgeutil_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Underestimated is a custom implementation that hints at fewer bytes than it
+// writes, and trusts its size hint.
+type Underestimated uint64
+
+func (Underestimated) SizeHint() int {
+	return 4
+}
+
+func (u Underestimated) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	binary.BigEndian.PutUint64(buf, uint64(u))
+	return buf[8:], rem - 8, nil
+}
+
+func (u *Underestimated) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.UnmarshalU64((*uint64)(u), buf, rem)
+}
+
+// Overestimated is a custom implementation that hints at more bytes than it
+// writes.
+type Overestimated uint64
+
+func (Overestimated) SizeHint() int {
+	return 12
+}
+
+func (o Overestimated) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU64(uint64(o), buf, rem)
+}
+
+func (o *Overestimated) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.UnmarshalU64((*uint64)(o), buf, rem)
+}
+
+// Exploding is a custom implementation that panics when it is marshaled,
+// regardless of the size of the buffer.
+type Exploding uint8
+
+func (Exploding) SizeHint() int {
+	return 1
+}
+
+func (Exploding) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	panic("boom")
+}
+
+func (e *Exploding) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.UnmarshalU8((*uint8)(e), buf, rem)
+}
+
+// Misindexed is a custom implementation that always panics with an index out
+// of range when it is marshaled, regardless of the size of the buffer.
+type Misindexed []uint8
+
+func (m Misindexed) SizeHint() int {
+	return surge.SizeHintBytes(m)
+}
+
+func (m Misindexed) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf[0] = m[len(m)]
+	return buf, rem, nil
+}
+
+func (m *Misindexed) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.UnmarshalBytes((*[]byte)(m), buf, rem)
+}
+
+var _ = Describe("SizeHintCheck", func() {
+	Context("when the size hint is accurate", func() {
+		It("should succeed", func() {
+			for _, t := range []reflect.Type{
+				reflect.TypeOf(Record{}),
+				reflect.TypeOf(map[string][]uint16{}),
+				reflect.TypeOf([]Forgetful{}),
+			} {
+				for trial := 0; trial < 10; trial++ {
+					Expect(surgeutil.SizeHintCheckWithOptions(t, surgeutil.Options{StrictSizeHint: true})).To(Succeed())
+				}
+			}
+		})
+	})
+
+	Context("when the size hint under-estimates", func() {
+		It("should return an error with the magnitude", func() {
+			err := surgeutil.SizeHintCheck(reflect.TypeOf(Underestimated(0)))
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Error()).To(ContainSubstring("under-estimates by 4 bytes"))
+		})
+	})
+
+	Context("when marshaling panics", func() {
+		It("should return an error with the panic", func() {
+			err := surgeutil.SizeHintCheck(reflect.TypeOf(Exploding(0)))
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Error()).To(ContainSubstring("panicked: boom"))
+
+			err = surgeutil.SizeHintCheck(reflect.TypeOf(Misindexed{}))
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Error()).To(ContainSubstring("index out of range"))
+		})
+	})
+
+	Context("when the size hint over-estimates", func() {
+		It("should warn with the magnitude", func() {
+			warnings := []string{}
+			logf := func(format string, args ...interface{}) {
+				warnings = append(warnings, fmt.Sprintf(format, args...))
+			}
+			t := reflect.TypeOf([]Overestimated{})
+			Expect(surgeutil.SizeHintCheckWithOptions(t, surgeutil.Options{Seed: 1, Logf: logf})).To(Succeed())
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0]).To(ContainSubstring("over-estimates by"))
+		})
+
+		It("should return an error when strict", func() {
+			t := reflect.TypeOf([]Overestimated{})
+			err := surgeutil.SizeHintCheckWithOptions(t, surgeutil.Options{Seed: 1, StrictSizeHint: true})
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Value).To(Equal([]Overestimated{0}))
+			Expect(f.Error()).To(ContainSubstring("over-estimates by 4 bytes"))
+		})
+	})
+})
@@ -1,11 +1,9 @@
 package surgeutil
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
 	"reflect"
-	"testing/quick"
-	"time"
 
 	"github.com/renproject/surge"
 )
@@ -16,24 +14,30 @@ import (
 // generation, marshaling, or unmarshaling return an error, or if the two
 // instances are unequal. Otherwise, it returns nil.
 func MarshalUnmarshalCheck(t reflect.Type) error {
-	// Generate
-	x, ok := quick.Value(t, rand.New(rand.NewSource(time.Now().UnixNano())))
-	if !ok {
-		return fmt.Errorf("cannot generate value of type %v", t)
-	}
+	return MarshalUnmarshalCheckWithOptions(t, Options{})
+}
+
+// MarshalUnmarshalCheckWithOptions is the same as MarshalUnmarshalCheck, but
+// uses the given options. When the check fails, an ErrCheckFailed is returned
+// for the smallest value that fails.
+func MarshalUnmarshalCheckWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, marshalUnmarshal)
+}
+
+func marshalUnmarshal(x reflect.Value, opts Options) error {
 	// Marshal
 	data, err := surge.ToBinary(x.Interface())
 	if err != nil {
-		return fmt.Errorf("cannot marshal: %v", err)
+		return fmt.Errorf("cannot marshal: %w", err)
 	}
 	// Unmarshal
-	y := reflect.New(t)
+	y := reflect.New(x.Type())
 	if err := surge.FromBinary(y.Interface(), data); err != nil {
-		return fmt.Errorf("cannot unmarshal: %v", err)
+		return fmt.Errorf("cannot unmarshal: %w", err)
 	}
 	// Equality
-	if !reflect.DeepEqual(x.Interface(), y.Elem().Interface()) {
-		return fmt.Errorf("unequal")
+	if d := bitwiseDiff(x.Interface(), y.Elem().Interface()); d != "" {
+		return fmt.Errorf("unequal: %v", d)
 	}
 	return nil
 }
@@ -42,17 +46,36 @@ func MarshalUnmarshalCheck(t reflect.Type) error {
 // random bytes into that instance. It returns nothing, but is expected to not
 // panic.
 func Fuzz(t reflect.Type) {
+	if err := FuzzWithOptions(t, Options{}); err != nil {
+		panic(err)
+	}
+}
+
+// FuzzWithOptions is the same as Fuzz, but uses the given options. When
+// unmarshaling panics, the panic is recovered and an ErrCheckFailed that
+// contains the random bytes is returned.
+func FuzzWithOptions(t reflect.Type, opts Options) (err error) {
+	r, seed, err := newRand(opts)
+	if err != nil {
+		return err
+	}
 	// Fuzz data
-	data, ok := quick.Value(reflect.TypeOf([]byte{}), rand.New(rand.NewSource(time.Now().UnixNano())))
-	if !ok {
-		panic(fmt.Errorf("cannot generate value of type %v", t))
+	data, err := Generate(reflect.TypeOf([]byte{}), r, opts)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = NewErrCheckFailed(seed, nil, data.Bytes(), fmt.Errorf("unmarshal %v panicked: %v", t, p))
+		}
+	}()
 	// Unmarshal
 	x := reflect.New(t)
 	if err := surge.FromBinary(x.Interface(), data.Bytes()); err != nil {
 		// Ignore the error, because we are only interested in whether or not
 		// the unmarshaling causes a panic.
 	}
+	return nil
 }
 
 // MarshalBufTooSmallSparse generates a random intance of a type, and then
@@ -62,13 +85,28 @@ func Fuzz(t reflect.Type) {
 // The number of buffer sizes tested is determinted by the given integer. A
 // value of 0 means that all buffer sizes will be tested.
 func MarshalBufTooSmallSparse(t reflect.Type, steps int) error {
-	x, ok := quick.Value(t, rand.New(rand.NewSource(time.Now().UnixNano())))
-	if !ok {
-		return fmt.Errorf("cannot generate value of type %v", t)
-	}
+	return MarshalBufTooSmallWithOptions(t, Options{Steps: steps})
+}
+
+// MarshalBufTooSmall generates a random intance of a type, and then attempts to
+// marshal it into a buffer that is too small. It returns an error when
+// marshaling succeeds. Otherwise, it returns nil.
+//
+// Equivalent to MarshalBufTooSmallSparse(t, 0).
+func MarshalBufTooSmall(t reflect.Type) error {
+	return MarshalBufTooSmallSparse(t, 0)
+}
+
+// MarshalBufTooSmallWithOptions is the same as MarshalBufTooSmall, but uses
+// the given options. When the check fails, an ErrCheckFailed is returned
+// for the smallest value that fails.
+func MarshalBufTooSmallWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, marshalBufTooSmall)
+}
 
+func marshalBufTooSmall(x reflect.Value, opts Options) error {
 	size := surge.SizeHint(x.Interface())
-	step := stepSize(size, steps)
+	step := stepSize(size, opts.Steps)
 	fullBuf := make([]byte, size)
 	for bufLen := 0; bufLen < size; bufLen += step {
 		buf := fullBuf[:bufLen]
@@ -80,15 +118,6 @@ func MarshalBufTooSmallSparse(t reflect.Type, steps int) error {
 	return nil
 }
 
-// MarshalBufTooSmall generates a random intance of a type, and then attempts to
-// marshal it into a buffer that is too small. It returns an error when
-// marshaling succeeds. Otherwise, it returns nil.
-//
-// Equivalent to MarshalBufTooSmallSparse(t, 0).
-func MarshalBufTooSmall(t reflect.Type) error {
-	return MarshalBufTooSmallSparse(t, 0)
-}
-
 // MarshalRemTooSmallSparse generates a random intance of a type, and then
 // attempts to marshal when a remaining memory quota that is too small. It
 // returns an error when marshaling succeeds. Otherwise, it returns nil.
@@ -96,20 +125,7 @@ func MarshalBufTooSmall(t reflect.Type) error {
 // The number of buffer sizes tested is determinted by the given integer. A
 // value of 0 means that all buffer sizes will be tested.
 func MarshalRemTooSmallSparse(t reflect.Type, steps int) error {
-	x, ok := quick.Value(t, rand.New(rand.NewSource(time.Now().UnixNano())))
-	if !ok {
-		return fmt.Errorf("cannot generate value of type %v", t)
-	}
-
-	size := surge.SizeHint(x.Interface())
-	step := stepSize(size, steps)
-	buf := make([]byte, size)
-	for rem := 0; rem < size; rem += step {
-		if _, _, err := surge.Marshal(x.Interface(), buf, rem); err == nil {
-			return fmt.Errorf("unexpected error: %v", err)
-		}
-	}
-	return nil
+	return MarshalRemTooSmallWithOptions(t, Options{Steps: steps})
 }
 
 // MarshalRemTooSmall generates a random intance of a type, and then attempts to
@@ -121,6 +137,25 @@ func MarshalRemTooSmall(t reflect.Type) error {
 	return MarshalRemTooSmallSparse(t, 0)
 }
 
+// MarshalRemTooSmallWithOptions is the same as MarshalRemTooSmall, but uses
+// the given options. When the check fails, an ErrCheckFailed is returned
+// for the smallest value that fails.
+func MarshalRemTooSmallWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, marshalRemTooSmall)
+}
+
+func marshalRemTooSmall(x reflect.Value, opts Options) error {
+	size := surge.SizeHint(x.Interface())
+	step := stepSize(size, opts.Steps)
+	buf := make([]byte, size)
+	for rem := 0; rem < size; rem += step {
+		if _, _, err := surge.Marshal(x.Interface(), buf, rem); err == nil {
+			return fmt.Errorf("unexpected success: %v < %v", rem, size)
+		}
+	}
+	return nil
+}
+
 // UnmarshalBufTooSmallSparse generates a random intance of a type, marshals it
 // into binary, and then attempts to unmarshal the result with a buffer that is
 // too small. It returns an error when marshaling succeeds. Otherwise, it
@@ -129,36 +164,48 @@ func MarshalRemTooSmall(t reflect.Type) error {
 // The number of buffer sizes tested is determinted by the given integer. A
 // value of 0 means that all buffer sizes will be tested.
 func UnmarshalBufTooSmallSparse(t reflect.Type, steps int) error {
-	x, ok := quick.Value(t, rand.New(rand.NewSource(time.Now().UnixNano())))
-	if !ok {
-		return fmt.Errorf("cannot generate value of type %v", t)
-	}
+	return UnmarshalBufTooSmallWithOptions(t, Options{Steps: steps})
+}
+
+// UnmarshalBufTooSmall generates a random intance of a type, marshals it into
+// binary, and then attempts to unmarshal the result with a buffer that is too
+// small. It returns an error when unmarshaling succeeds, or panics. Otherwise,
+// it returns nil.
+//
+// Equivalent to UnmarshalBufTooSmallSparse(t, 0).
+func UnmarshalBufTooSmall(t reflect.Type) error {
+	return UnmarshalBufTooSmallSparse(t, 0)
+}
 
+// UnmarshalBufTooSmallWithOptions is the same as UnmarshalBufTooSmall, but
+// uses the given options. When the check fails, an ErrCheckFailed is returned
+// for the smallest value that fails.
+func UnmarshalBufTooSmallWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, unmarshalBufTooSmall)
+}
+
+func unmarshalBufTooSmall(x reflect.Value, opts Options) error {
 	buf, err := surge.ToBinary(x.Interface())
 	if err != nil {
-		return fmt.Errorf("unexpected error: %v", err)
+		return fmt.Errorf("unexpected error: %w", err)
 	}
 
-	step := stepSize(len(buf), steps)
-	y := reflect.New(t)
+	step := stepSize(len(buf), opts.Steps)
+	y := reflect.New(x.Type())
 	for bufLen := 0; bufLen < len(buf); bufLen += step {
-		if _, _, err := surge.Unmarshal(y.Interface(), buf[:bufLen], surge.MaxBytes); err == nil {
+		_, _, err := call(func() ([]byte, int, error) {
+			return surge.Unmarshal(y.Interface(), buf[:bufLen], surge.MaxBytes)
+		})
+		if err == nil {
 			return fmt.Errorf("unexpected success: %v < %v", bufLen, len(buf))
 		}
+		if errors.As(err, &errPanicked{}) {
+			return fmt.Errorf("truncated to %v of %v bytes: %w", bufLen, len(buf), err)
+		}
 	}
 	return nil
 }
 
-// UnmarshalBufTooSmall generates a random intance of a type, marshals it into
-// binary, and then attempts to unmarshal the result with a buffer that is too
-// small. It returns an error when marshaling succeeds. Otherwise, it returns
-// nil.
-//
-// Equivalent to UnmarshalBufTooSmallSparse(t, 0).
-func UnmarshalBufTooSmall(t reflect.Type) error {
-	return UnmarshalBufTooSmallSparse(t, 0)
-}
-
 // UnmarshalRemTooSmallSparse generates a random intance of a type, marshals it
 // into binary, and then attempts to unmarshal the result with a remaining
 // memory quota that is too small. It returns an error when marshaling
@@ -167,15 +214,32 @@ func UnmarshalBufTooSmall(t reflect.Type) error {
 // The number of buffer sizes tested is determinted by the given integer. A
 // value of 0 means that all buffer sizes will be tested.
 func UnmarshalRemTooSmallSparse(t reflect.Type, steps int) error {
-	x, ok := quick.Value(t, rand.New(rand.NewSource(time.Now().UnixNano())))
-	if !ok {
-		return fmt.Errorf("cannot generate value of type %v", t)
-	}
+	return UnmarshalRemTooSmallWithOptions(t, Options{Steps: steps})
+}
 
+// UnmarshalRemTooSmall generates a random intance of a type, marshals it into
+// binary, and then attempts to unmarshal the result with a remaining memory
+// quota that is too small. It returns an error when marshaling succeeds.
+// Otherwise, it returns nil.
+//
+// Equivalent to UnmarshalRemTooSmallSparse(t, 0).
+func UnmarshalRemTooSmall(t reflect.Type) error {
+	return UnmarshalRemTooSmallSparse(t, 0)
+}
+
+// UnmarshalRemTooSmallWithOptions is the same as UnmarshalRemTooSmall, but
+// uses the given options. When the check fails, an ErrCheckFailed is returned
+// for the smallest value that fails.
+func UnmarshalRemTooSmallWithOptions(t reflect.Type, opts Options) error {
+	return check(t, opts, unmarshalRemTooSmall)
+}
+
+func unmarshalRemTooSmall(x reflect.Value, opts Options) error {
+	t := x.Type()
 	size := surge.SizeHint(x.Interface())
 	buf := make([]byte, size)
 	if _, _, err := surge.Marshal(x.Interface(), buf, surge.MaxBytes); err != nil {
-		return fmt.Errorf("unexpected error: %v", err)
+		return fmt.Errorf("unexpected error: %w", err)
 	}
 
 	rem := size
@@ -184,7 +248,7 @@ func UnmarshalRemTooSmallSparse(t reflect.Type, steps int) error {
 		rem += x.Len() * int(t.Key().Size()+t.Elem().Size())
 	}
 
-	step := stepSize(rem, steps)
+	step := stepSize(rem, opts.Steps)
 	y := reflect.New(t)
 	for rem2 := 0; rem2 < rem; rem2 += step {
 		if _, _, err := surge.Unmarshal(y.Interface(), buf, rem2); err == nil {
@@ -194,14 +258,34 @@ func UnmarshalRemTooSmallSparse(t reflect.Type, steps int) error {
 	return nil
 }
 
-// UnmarshalRemTooSmall generates a random intance of a type, marshals it into
-// binary, and then attempts to unmarshal the result with a remaining memory
-// quota that is too small. It returns an error when marshaling succeeds.
-// Otherwise, it returns nil.
-//
-// Equivalent to UnmarshalRemTooSmallSparse(t, 0).
-func UnmarshalRemTooSmall(t reflect.Type) error {
-	return UnmarshalRemTooSmallSparse(t, 0)
+// check generates a random instance of a type, and then checks that it has a
+// property. When it does not, the instance is shrunk, and an ErrCheckFailed is
+// returned for the smallest instance that does not have the property.
+func check(t reflect.Type, opts Options, property func(x reflect.Value, opts Options) error) error {
+	r, seed, err := newRand(opts)
+	if err != nil {
+		return err
+	}
+	x, err := Generate(t, r, opts)
+	if err != nil {
+		return err
+	}
+	cause := property(x, opts)
+	if cause == nil {
+		return nil
+	}
+	// Warnings are not reported while shrinking. Properties that fail
+	// nondeterministically might not fail for the shrunk value, in which case
+	// the original value is reported.
+	opts.Logf = nil
+	// Only values that fail with the same cause are accepted, so that the
+	// failure being reported is not replaced by a different one.
+	shrunk := shrink(x, func(x reflect.Value) bool { return sameCause(cause, property(x, opts)) }, opts.MaxShrinks)
+	if err := property(shrunk, opts); sameCause(cause, err) {
+		x, cause = shrunk, err
+	}
+	data, _ := encode(x.Interface(), surge.SizeHint(x.Interface()))
+	return NewErrCheckFailed(seed, x.Interface(), data, cause)
 }
 
 func stepSize(max, steps int) int {
@@ -1 +1,227 @@
-package surgeutil_test
\ No newline at end of file
+package surgeutil_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Forgetful is a custom implementation that forgets its value when it is
+// unmarshaled.
+type Forgetful uint64
+
+func (f Forgetful) SizeHint() int {
+	return surge.SizeHintU64
+}
+
+func (f Forgetful) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU64(uint64(f), buf, rem)
+}
+
+func (f *Forgetful) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	x := uint64(0)
+	buf, rem, err := surge.UnmarshalU64(&x, buf, rem)
+	*f = 0
+	return buf, rem, err
+}
+
+// Panicky is a custom implementation that panics when it is unmarshaled.
+type Panicky struct{}
+
+func (Panicky) SizeHint() int {
+	return 0
+}
+
+func (Panicky) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return buf, rem, nil
+}
+
+func (*Panicky) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	panic("unmarshal")
+}
+
+// Lossy is a custom implementation that drops its highest bit when it is
+// unmarshaled.
+type Lossy uint8
+
+func (l Lossy) SizeHint() int {
+	return surge.SizeHintU8
+}
+
+func (l Lossy) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return surge.MarshalU8(uint8(l), buf, rem)
+}
+
+func (l *Lossy) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	x := uint8(0)
+	buf, rem, err := surge.UnmarshalU8(&x, buf, rem)
+	*l = Lossy(x & 0x7f)
+	return buf, rem, err
+}
+
+// LossyTicker has a field with a fixed length, which cannot be marshaled if it
+// is shortened.
+type LossyTicker struct {
+	Ticker string `surge:"fixed=4"`
+	Amount Lossy
+}
+
+var _ = Describe("Surgeutil", func() {
+	t := reflect.TypeOf([]Forgetful{})
+
+	failure := func(err error) surgeutil.ErrCheckFailed {
+		Expect(err).To(HaveOccurred())
+		checkFailed := surgeutil.ErrCheckFailed{}
+		Expect(errors.As(err, &checkFailed)).To(BeTrue())
+		return checkFailed
+	}
+
+	Context("when a check fails", func() {
+		It("should report the seed, value, and binary representation", func() {
+			f := failure(surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: 1}))
+			Expect(f.Seed).To(Equal(int64(1)))
+			Expect(f.Data).To(Equal(func() []byte {
+				data, err := surge.ToBinary(f.Value)
+				Expect(err).ToNot(HaveOccurred())
+				return data
+			}()))
+			Expect(f.Error()).To(ContainSubstring("SURGEUTIL_SEED=1"))
+		})
+
+		It("should generate the same value for the same seed", func() {
+			f1 := failure(surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: 2, MaxShrinks: -1}))
+			f2 := failure(surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: 2, MaxShrinks: -1}))
+			f3 := failure(surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: 3, MaxShrinks: -1}))
+			Expect(f1.Value).To(Equal(f2.Value))
+			Expect(f1.Value).ToNot(Equal(f3.Value))
+		})
+	})
+
+	Context("when the seed environment variable is set", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv(surgeutil.SeedEnv)).To(Succeed())
+		})
+
+		It("should replay the seed", func() {
+			Expect(os.Setenv(surgeutil.SeedEnv, "42")).To(Succeed())
+			f := failure(surgeutil.MarshalUnmarshalCheck(t))
+			Expect(f.Seed).To(Equal(int64(42)))
+			f = failure(surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: 1}))
+			Expect(f.Seed).To(Equal(int64(1)))
+		})
+
+		It("should return an error when the seed is invalid", func() {
+			Expect(os.Setenv(surgeutil.SeedEnv, "forty-two")).To(Succeed())
+			err := surgeutil.MarshalUnmarshalCheck(t)
+			Expect(err).To(HaveOccurred())
+			Expect(errors.As(err, &surgeutil.ErrCheckFailed{})).To(BeFalse())
+		})
+	})
+
+	Context("when fuzzing panics", func() {
+		It("should report the seed and the random bytes", func() {
+			t := reflect.TypeOf(Panicky{})
+			f := failure(surgeutil.FuzzWithOptions(t, surgeutil.Options{Seed: 4}))
+			Expect(f.Seed).To(Equal(int64(4)))
+			Expect(f.Error()).To(ContainSubstring("panicked"))
+			Expect(func() { surgeutil.Fuzz(t) }).To(Panic())
+		})
+	})
+
+	Context("when a type is well-behaved", func() {
+		It("should pass all checks", func() {
+			t := reflect.TypeOf(map[string][]uint16{})
+			opts := surgeutil.Options{Seed: 5, Steps: 10}
+			Expect(surgeutil.MarshalUnmarshalCheckWithOptions(t, opts)).To(Succeed())
+			Expect(surgeutil.FuzzWithOptions(t, opts)).To(Succeed())
+			Expect(surgeutil.MarshalBufTooSmallWithOptions(t, opts)).To(Succeed())
+			Expect(surgeutil.MarshalRemTooSmallWithOptions(t, opts)).To(Succeed())
+			Expect(surgeutil.UnmarshalBufTooSmallWithOptions(t, opts)).To(Succeed())
+			Expect(surgeutil.UnmarshalRemTooSmallWithOptions(t, opts)).To(Succeed())
+		})
+	})
+})
+
+var _ = Describe("Shrink", func() {
+	Context("when a check fails", func() {
+		It("should return the smallest value that fails", func() {
+			t := reflect.TypeOf([]Forgetful{})
+			err := surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: 1})
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(f.Value).To(Equal([]Forgetful{1}))
+			Expect(f.Data).To(Equal([]byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1}))
+			Expect(f.Error()).To(ContainSubstring("000000010000000000000001"))
+		})
+
+		It("should not shrink when shrinking is disabled", func() {
+			t := reflect.TypeOf([]Forgetful{})
+			err := surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: 1, MaxShrinks: -1})
+			f := surgeutil.ErrCheckFailed{}
+			Expect(errors.As(err, &f)).To(BeTrue())
+			Expect(len(f.Value.([]Forgetful))).To(BeNumerically(">", 1))
+		})
+	})
+
+	Context("when a smaller value fails for a different reason", func() {
+		It("should not shrink to the smaller value", func() {
+			t := reflect.TypeOf(LossyTicker{})
+			failed := 0
+			for seed := int64(1); seed <= 20; seed++ {
+				err := surgeutil.MarshalUnmarshalCheckWithOptions(t, surgeutil.Options{Seed: seed})
+				if err == nil {
+					continue
+				}
+				failed++
+				f := surgeutil.ErrCheckFailed{}
+				Expect(errors.As(err, &f)).To(BeTrue())
+				Expect(f.Value.(LossyTicker).Ticker).To(HaveLen(4))
+				Expect(f.Value.(LossyTicker).Amount).To(BeNumerically(">=", 0x80))
+				Expect(f.Error()).To(ContainSubstring("unequal"))
+			}
+			Expect(failed).To(BeNumerically(">", 0))
+		})
+	})
+
+	Context("when shrinking nested values", func() {
+		It("should truncate slices, drop map entries, shorten strings, and zero scalars", func() {
+			type Nested struct {
+				Name   string
+				Values map[string][]int32
+				Flag   bool
+				Ratio  float64
+				Pair   [2]uint16
+			}
+			x := Nested{
+				Name:   "abcdefgh",
+				Values: map[string][]int32{"a": {1, 2, 3}, "b": {-100, 7}, "c": {}},
+				Flag:   true,
+				Ratio:  3.5,
+				Pair:   [2]uint16{10, 20},
+			}
+			// Fails while there is an int32 that is less than -10, and the
+			// second element of the pair is non-zero.
+			fails := func(v interface{}) bool {
+				y := v.(Nested)
+				for _, values := range y.Values {
+					for _, value := range values {
+						if value < -10 && y.Pair[1] != 0 {
+							return true
+						}
+					}
+				}
+				return false
+			}
+			Expect(surgeutil.Shrink(x, fails, 0)).To(Equal(Nested{
+				Values: map[string][]int32{"b": {-12}},
+				Pair:   [2]uint16{0, 1},
+			}))
+		})
+	})
+})
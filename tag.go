@@ -0,0 +1,226 @@
+package surge
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fieldTag is the parsed surge struct tag of a field. The surge struct tag is
+// a comma-separated list of key/value pairs:
+//
+//  maxlen=N  the string, slice, or map must not have more than N elements
+//  fixed=N   the string, or byte slice, must have exactly N elements, and is
+//            represented without a length prefix
+//
+type fieldTag struct {
+	maxLen int
+	fixed  int
+}
+
+// A Tag is the parsed surge struct tag of a field.
+type Tag struct {
+	// MaxLen is the maximum number of elements in the string, slice, or map,
+	// or zero if there is no maximum.
+	MaxLen int
+	// Fixed is the exact number of elements in the string, or byte slice,
+	// which is represented without a length prefix, or zero if the length is
+	// not fixed.
+	Fixed int
+}
+
+// FieldTag parses the surge struct tag of a field. The zero Tag is returned
+// when the field does not have a surge struct tag, and an ErrInvalidTag is
+// returned when the struct tag is invalid.
+//
+//  tag, err := surge.FieldTag(reflect.TypeOf(MyStruct{}).Field(0))
+//  if err != nil {
+//      panic(err)
+//  }
+//
+func FieldTag(field reflect.StructField) (Tag, error) {
+	str, ok := field.Tag.Lookup("surge")
+	if !ok {
+		return Tag{}, nil
+	}
+	tag, err := parseFieldTag(field, str)
+	if err != nil {
+		return Tag{}, err
+	}
+	return Tag{MaxLen: tag.maxLen, Fixed: tag.fixed}, nil
+}
+
+func (tag fieldTag) isZero() bool {
+	return tag == fieldTag{}
+}
+
+// structTagsCache maps struct types to the result of parsing their struct tags,
+// so that struct tags are only parsed once per type.
+var structTagsCache sync.Map
+
+type structTagsResult struct {
+	tags []fieldTag
+	err  error
+}
+
+// structTags returns the parsed surge struct tags for all fields of a struct
+// type, or nil if none of the fields have a surge struct tag.
+func structTags(t reflect.Type) ([]fieldTag, error) {
+	if result, ok := structTagsCache.Load(t); ok {
+		return result.(structTagsResult).tags, result.(structTagsResult).err
+	}
+	tags, err := parseStructTags(t)
+	structTagsCache.Store(t, structTagsResult{tags: tags, err: err})
+	return tags, err
+}
+
+func parseStructTags(t reflect.Type) ([]fieldTag, error) {
+	var tags []fieldTag
+	numField := t.NumField()
+	for i := 0; i < numField; i++ {
+		field := t.Field(i)
+		str, ok := field.Tag.Lookup("surge")
+		if !ok {
+			continue
+		}
+		tag, err := parseFieldTag(field, str)
+		if err != nil {
+			return nil, err
+		}
+		if tags == nil {
+			tags = make([]fieldTag, numField)
+		}
+		tags[i] = tag
+	}
+	return tags, nil
+}
+
+func parseFieldTag(field reflect.StructField, str string) (fieldTag, error) {
+	tag := fieldTag{}
+	for _, opt := range strings.Split(str, ",") {
+		kv := strings.SplitN(strings.TrimSpace(opt), "=", 2)
+		if len(kv) != 2 {
+			return tag, NewErrInvalidTag(field, fmt.Sprintf("expected key=value, got %q", opt))
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return tag, NewErrInvalidTag(field, fmt.Sprintf("expected non-negative integer, got %q", kv[1]))
+		}
+		switch kv[0] {
+		case "maxlen":
+			switch field.Type.Kind() {
+			case reflect.String, reflect.Slice, reflect.Map:
+			default:
+				return tag, NewErrInvalidTag(field, "maxlen requires a string, slice, or map")
+			}
+			if n == 0 {
+				return tag, NewErrInvalidTag(field, "maxlen must be positive")
+			}
+			tag.maxLen = n
+		case "fixed":
+			if field.Type.Kind() != reflect.String && !(field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Uint8) {
+				return tag, NewErrInvalidTag(field, "fixed requires a string or byte slice")
+			}
+			if n == 0 {
+				return tag, NewErrInvalidTag(field, "fixed must be positive")
+			}
+			tag.fixed = n
+		default:
+			return tag, NewErrInvalidTag(field, fmt.Sprintf("unknown key %q", kv[0]))
+		}
+	}
+	if tag.maxLen > 0 && tag.fixed > 0 {
+		return tag, NewErrInvalidTag(field, "maxlen cannot be used with fixed")
+	}
+	if HasCustomImplementation(field.Type) {
+		return tag, NewErrInvalidTag(field, "type has a custom implementation")
+	}
+	return tag, nil
+}
+
+// HasCustomImplementation returns true if values of the type are marshaled or
+// unmarshaled by a custom implementation, in which case their binary
+// representation is unknown.
+//
+//  if surge.HasCustomImplementation(reflect.TypeOf(x)) {
+//      // The binary representation of x cannot be inspected
+//  }
+//
+func HasCustomImplementation(t reflect.Type) bool {
+	ptr := reflect.PtrTo(t)
+	return t.Implements(marshaler) ||
+		t.Implements(marshalerWithOptions) ||
+		ptr.Implements(unmarshaler) ||
+		ptr.Implements(unmarshalerWithOptions)
+}
+
+func (codec *Codec) sizeHintTagged(v reflect.Value, tag fieldTag, depth int) int {
+	if tag.fixed > 0 {
+		return tag.fixed
+	}
+	return codec.sizeHintReflected(v, depth)
+}
+
+func (codec *Codec) marshalTagged(v reflect.Value, tag fieldTag, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if tag.fixed > 0 {
+		return codec.marshalFixed(v, tag.fixed, buf, rem)
+	}
+	if tag.maxLen > 0 && v.Len() > tag.maxLen {
+		return buf, rem, ErrMaxLenExceeded
+	}
+	return codec.marshalReflected(v, buf, rem, depth)
+}
+
+func (codec *Codec) unmarshalTagged(v reflect.Value, tag fieldTag, buf []byte, rem int, depth int) ([]byte, int, error) {
+	if tag.fixed > 0 {
+		buf, rem, err := codec.unmarshalFixed(v, tag.fixed, buf, rem)
+		if err != nil {
+			return buf, rem, err
+		}
+		return buf, rem, validate(v)
+	}
+	// Peek at the length prefix so that the maximum length is checked before
+	// anything is allocated.
+	if tag.maxLen > 0 && len(buf) >= SizeHintU32 && uint64(codec.opts.ByteOrder.Uint32(buf)) > uint64(tag.maxLen) {
+		return buf, rem, ErrMaxLenExceeded
+	}
+	return codec.unmarshalReflected(v, buf, rem, depth)
+}
+
+// marshalFixed marshals a string, or byte slice, of a fixed length without a
+// length prefix.
+func (codec *Codec) marshalFixed(v reflect.Value, n int, buf []byte, rem int) ([]byte, int, error) {
+	if v.Len() != n {
+		return buf, rem, ErrFixedLenMismatch
+	}
+	if len(buf) < n || rem < n {
+		return buf, rem, ErrUnexpectedEndOfBuffer
+	}
+	if v.Kind() == reflect.String {
+		copy(buf, v.String())
+	} else {
+		copy(buf, v.Bytes())
+	}
+	return buf[n:], rem - n, nil
+}
+
+// unmarshalFixed unmarshals a string, or byte slice, of a fixed length without
+// a length prefix.
+func (codec *Codec) unmarshalFixed(v reflect.Value, n int, buf []byte, rem int) ([]byte, int, error) {
+	if len(buf) < n || rem < n {
+		return buf, rem, ErrUnexpectedEndOfBuffer
+	}
+	elem := v.Elem()
+	if elem.Kind() == reflect.String {
+		elem.SetString(string(buf[:n]))
+	} else if codec.opts.ZeroCopy {
+		elem.SetBytes(buf[:n:n])
+	} else {
+		bs := make([]byte, n)
+		copy(bs, buf)
+		elem.SetBytes(bs)
+	}
+	return buf[n:], rem - n, nil
+}
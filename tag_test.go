@@ -0,0 +1,212 @@
+package surge_test
+
+import (
+	"reflect"
+
+	"github.com/renproject/surge"
+	"github.com/renproject/surge/surgeutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type MaxLenStruct struct {
+	Signatures [][]byte          `surge:"maxlen=4"`
+	Name       string            `surge:"maxlen=8"`
+	Data       []byte            `surge:"maxlen=16"`
+	Votes      map[string]uint64 `surge:"maxlen=2"`
+	Unbounded  []uint64
+}
+
+type PubKey []byte
+
+type FixedStruct struct {
+	Key    PubKey `surge:"fixed=32"`
+	Ticker string `surge:"fixed=4"`
+	Hash   []byte `surge:"fixed=8"`
+	Memo   string
+}
+
+type InvalidFixedKindStruct struct {
+	X []uint64 `surge:"fixed=4"`
+}
+
+type InvalidFixedMaxLenStruct struct {
+	X []byte `surge:"fixed=4,maxlen=4"`
+}
+
+type InvalidKeyStruct struct {
+	X []byte `surge:"minlen=4"`
+}
+
+type InvalidValueStruct struct {
+	X []byte `surge:"maxlen=four"`
+}
+
+type InvalidKindStruct struct {
+	X uint64 `surge:"maxlen=4"`
+}
+
+type InvalidCustomStruct struct {
+	X Bar `surge:"maxlen=4"`
+}
+
+var _ = Describe("Tag", func() {
+	valid := func() MaxLenStruct {
+		return MaxLenStruct{
+			Signatures: [][]byte{{1}, {2}, {3}, {4}},
+			Name:       "12345678",
+			Data:       make([]byte, 16),
+			Votes:      map[string]uint64{"a": 1, "b": 2},
+			Unbounded:  make([]uint64, 100),
+		}
+	}
+
+	Context("when marshaling and then unmarshaling values within their max length", func() {
+		It("should return itself", func() {
+			x := valid()
+			data, err := surge.ToBinary(x)
+			Expect(err).ToNot(HaveOccurred())
+			y := MaxLenStruct{}
+			Expect(surge.FromBinary(&y, data)).To(Succeed())
+			Expect(y).To(Equal(x))
+		})
+	})
+
+	Context("when marshaling values that exceed their max length", func() {
+		It("should return an error", func() {
+			mutations := []func(x *MaxLenStruct){
+				func(x *MaxLenStruct) { x.Signatures = append(x.Signatures, []byte{5}) },
+				func(x *MaxLenStruct) { x.Name += "9" },
+				func(x *MaxLenStruct) { x.Data = append(x.Data, 0) },
+				func(x *MaxLenStruct) { x.Votes["c"] = 3 },
+			}
+			for _, mutate := range mutations {
+				x := valid()
+				mutate(&x)
+				_, err := surge.ToBinary(x)
+				Expect(err).To(Equal(surge.ErrMaxLenExceeded))
+			}
+		})
+	})
+
+	Context("when unmarshaling values that exceed their max length", func() {
+		It("should return an error before allocating", func() {
+			x := valid()
+			x.Signatures = nil
+			data, err := surge.ToBinary(x)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Claim that there are 2^32-1 signatures. Without the max length,
+			// this would be rejected by the memory quota instead.
+			data[0], data[1], data[2], data[3] = 0xFF, 0xFF, 0xFF, 0xFF
+			y := MaxLenStruct{}
+			_, _, err = surge.Unmarshal(&y, data, surge.MaxBytes)
+			Expect(err).To(Equal(surge.ErrMaxLenExceeded))
+
+			// Claim that there are 5 signatures, and provide them.
+			x = valid()
+			x.Signatures = append(x.Signatures, []byte{5})
+			data, err = surge.NewCodec(surge.Options{}).ToBinary(struct {
+				Signatures [][]byte
+				Name       string
+				Data       []byte
+				Votes      map[string]uint64
+				Unbounded  []uint64
+			}(x))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(surge.FromBinary(&y, data)).To(Equal(surge.ErrMaxLenExceeded))
+		})
+	})
+
+	Context("when marshaling and then unmarshaling fixed length values", func() {
+		It("should return itself without length prefixes", func() {
+			x := FixedStruct{
+				Key:    make(PubKey, 32),
+				Ticker: "BTC!",
+				Hash:   []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				Memo:   "memo",
+			}
+			x.Key[0] = 42
+			Expect(surge.SizeHint(x)).To(Equal(32 + 4 + 8 + 4 + 4))
+			data, err := surge.ToBinary(x)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(HaveLen(32 + 4 + 8 + 4 + 4))
+			Expect(data[0]).To(Equal(byte(42)))
+			Expect(string(data[32:36])).To(Equal("BTC!"))
+
+			y := FixedStruct{}
+			Expect(surge.FromBinary(&y, data)).To(Succeed())
+			Expect(y).To(Equal(x))
+
+			for n := 0; n < len(data); n++ {
+				_, _, err := surge.Unmarshal(&y, data[:n], surge.MaxBytes)
+				Expect(err).To(Equal(surge.ErrUnexpectedEndOfBuffer))
+			}
+		})
+	})
+
+	Context("when marshaling fixed length values with the wrong length", func() {
+		It("should return an error", func() {
+			x := FixedStruct{Key: make(PubKey, 31), Ticker: "BTC!", Hash: make([]byte, 8)}
+			_, err := surge.ToBinary(x)
+			Expect(err).To(Equal(surge.ErrFixedLenMismatch))
+
+			x = FixedStruct{Key: make(PubKey, 32), Ticker: "BTC", Hash: make([]byte, 8)}
+			_, err = surge.ToBinary(x)
+			Expect(err).To(Equal(surge.ErrFixedLenMismatch))
+		})
+	})
+
+	Context("when a tag is invalid", func() {
+		It("should return an error", func() {
+			for _, x := range []interface{}{InvalidKeyStruct{}, InvalidValueStruct{}, InvalidKindStruct{}, InvalidCustomStruct{}, InvalidFixedKindStruct{}, InvalidFixedMaxLenStruct{}} {
+				_, err := surge.ToBinary(x)
+				Expect(err).To(BeAssignableToTypeOf(surge.ErrInvalidTag{}))
+
+				y := reflect.New(reflect.TypeOf(x))
+				err = surge.FromBinary(y.Interface(), make([]byte, 64))
+				Expect(err).To(BeAssignableToTypeOf(surge.ErrInvalidTag{}))
+			}
+		})
+	})
+
+	Context("when parsing the tag of a field", func() {
+		It("should return the maximum or fixed length", func() {
+			tag, err := surge.FieldTag(reflect.TypeOf(MaxLenStruct{}).Field(1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tag).To(Equal(surge.Tag{MaxLen: 8}))
+
+			tag, err = surge.FieldTag(reflect.TypeOf(FixedStruct{}).Field(0))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tag).To(Equal(surge.Tag{Fixed: 32}))
+
+			tag, err = surge.FieldTag(reflect.TypeOf(FixedStruct{}).Field(3))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tag).To(BeZero())
+		})
+
+		It("should return an error when the tag is invalid", func() {
+			for _, x := range []interface{}{InvalidKeyStruct{}, InvalidValueStruct{}, InvalidKindStruct{}, InvalidCustomStruct{}, InvalidFixedKindStruct{}, InvalidFixedMaxLenStruct{}} {
+				_, err := surge.FieldTag(reflect.TypeOf(x).Field(0))
+				Expect(err).To(BeAssignableToTypeOf(surge.ErrInvalidTag{}))
+			}
+		})
+	})
+
+	Context("when checking for a custom implementation", func() {
+		It("should return true for marshalers and unmarshalers", func() {
+			Expect(surge.HasCustomImplementation(reflect.TypeOf(Bar(0)))).To(BeTrue())
+			Expect(surge.HasCustomImplementation(reflect.TypeOf(PubKey{}))).To(BeFalse())
+			Expect(surge.HasCustomImplementation(reflect.TypeOf(FixedStruct{}))).To(BeFalse())
+		})
+	})
+
+	Context("when fuzzing", func() {
+		It("should not panic", func() {
+			for trial := 0; trial < 100; trial++ {
+				Expect(func() { surgeutil.Fuzz(reflect.TypeOf(MaxLenStruct{})) }).ToNot(Panic())
+			}
+		})
+	})
+})
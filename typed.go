@@ -0,0 +1,99 @@
+package surge
+
+import (
+	"reflect"
+)
+
+// Encode a value into its binary representation. It is the type-safe
+// equivalent of ToBinary.
+//
+//  data, err := surge.Encode(x)
+//  if err != nil {
+//      panic(err)
+//  }
+//
+func Encode[T any](v T) ([]byte, error) {
+	return ToBinary(v)
+}
+
+// Decode a value from its binary representation. It is the type-safe
+// equivalent of FromBinary, and does not require a pointer.
+//
+//  x, err := surge.Decode[MyStruct](data)
+//  if err != nil {
+//      panic(err)
+//  }
+//
+func Decode[T any](buf []byte) (T, error) {
+	var v T
+	err := FromBinary(&v, buf)
+	return v, err
+}
+
+// A TypedCodec marshals and unmarshals values of one type. The type is planned
+// once, when the TypedCodec is constructed, instead of every time that a value
+// is marshaled or unmarshaled: whether or not the type is supported is checked,
+// custom implementations are found, struct tags are parsed, and the sizes of
+// fixed size values are computed.
+type TypedCodec[T any] struct {
+	codec *Codec
+	plan  *plan
+}
+
+// NewTypedCodec returns a TypedCodec for values of type T that uses the given
+// options. An error is returned if T, or any type nested inside it, cannot be
+// marshaled or unmarshaled, or has an invalid struct tag.
+//
+//  codec, err := surge.NewTypedCodec[MyStruct](surge.DefaultOptions())
+//  if err != nil {
+//      panic(err)
+//  }
+//
+func NewTypedCodec[T any](opts Options) (*TypedCodec[T], error) {
+	var v T
+	p, err := newPlan(reflect.TypeOf(&v).Elem(), map[reflect.Type]*plan{})
+	if err != nil {
+		return nil, err
+	}
+	return &TypedCodec[T]{codec: NewCodec(opts), plan: p}, nil
+}
+
+// Options returns the options used by the TypedCodec.
+func (codec *TypedCodec[T]) Options() Options {
+	return codec.codec.Options()
+}
+
+// Encode a value into its binary representation.
+func (codec *TypedCodec[T]) Encode(v T) ([]byte, error) {
+	buf := make([]byte, codec.SizeHint(v))
+	_, _, err := codec.Marshal(v, buf, codec.codec.opts.MaxBytes)
+	return buf, err
+}
+
+// Decode a value from its binary representation.
+func (codec *TypedCodec[T]) Decode(buf []byte) (T, error) {
+	var v T
+	tail, _, err := codec.Unmarshal(&v, buf, codec.codec.opts.MaxBytes)
+	if err == nil && codec.codec.opts.Strict && len(tail) != 0 {
+		err = ErrTrailingBytes
+	}
+	return v, err
+}
+
+// SizeHint returns the number of bytes required to store a value in its binary
+// representation.
+func (codec *TypedCodec[T]) SizeHint(v T) int {
+	return codec.plan.sizeHint(codec.codec, reflect.ValueOf(&v).Elem(), 0)
+}
+
+// Marshal a value into its binary representation, and store the value in a byte
+// slice.
+func (codec *TypedCodec[T]) Marshal(v T, buf []byte, rem int) ([]byte, int, error) {
+	return codec.plan.marshal(codec.codec, reflect.ValueOf(&v).Elem(), buf, rem, 0)
+}
+
+// Unmarshal a value from its binary representation by reading from a byte
+// slice.
+func (codec *TypedCodec[T]) Unmarshal(v *T, buf []byte, rem int) ([]byte, int, error) {
+	return codec.plan.unmarshal(codec.codec, reflect.ValueOf(v), buf, rem, 0)
+}
@@ -0,0 +1,183 @@
+package surge_test
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"reflect"
+	"testing/quick"
+
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type UnsupportedStruct struct {
+	Name     string
+	Callback func()
+}
+
+type UnsupportedPointerStruct struct {
+	Next *UnsupportedPointerStruct
+}
+
+// MarshalOnly is a custom implementation of marshaling, but not of
+// unmarshaling, for a kind that cannot be unmarshaled by default.
+type MarshalOnly func()
+
+func (MarshalOnly) SizeHint() int {
+	return 0
+}
+
+func (MarshalOnly) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	return buf, rem, nil
+}
+
+// expectTypedCodecToAgree checks that a TypedCodec returns the same results as
+// a Codec with the same options, when marshaling a value into buffers of every
+// length, and when unmarshaling every prefix of its binary representation.
+func expectTypedCodecToAgree[T any](x T, opts surge.Options) {
+	codec := surge.NewCodec(opts)
+	typed, err := surge.NewTypedCodec[T](opts)
+	Expect(err).ToNot(HaveOccurred())
+
+	sizeHint := codec.SizeHint(x)
+	Expect(typed.SizeHint(x)).To(Equal(sizeHint))
+	for n := 0; n <= sizeHint; n++ {
+		for _, rem := range []int{n, surge.MaxBytes} {
+			buf, typedBuf := make([]byte, n), make([]byte, n)
+			tail, rem1, err := codec.Marshal(x, buf, rem)
+			typedTail, rem2, typedErr := typed.Marshal(x, typedBuf, rem)
+			Expect([]interface{}{typedBuf, len(typedTail), rem2, typedErr}).To(Equal([]interface{}{buf, len(tail), rem1, err}))
+		}
+	}
+
+	data := make([]byte, sizeHint)
+	codec.Marshal(x, data, surge.MaxBytes)
+	for n := 0; n <= len(data); n++ {
+		for _, rem := range []int{n, surge.MaxBytes} {
+			y, typedY := new(T), new(T)
+			tail, rem1, err := codec.Unmarshal(y, data[:n], rem)
+			typedTail, rem2, typedErr := typed.Unmarshal(typedY, data[:n], rem)
+			Expect([]interface{}{*typedY, len(typedTail), rem2, typedErr}).To(Equal([]interface{}{*y, len(tail), rem1, err}))
+		}
+	}
+}
+
+var _ = Describe("Typed", func() {
+	Context("when encoding and then decoding", func() {
+		It("should return itself", func() {
+			f := func(x Model) bool {
+				data, err := surge.Encode(x)
+				Expect(err).ToNot(HaveOccurred())
+				y, err := surge.Decode[Model](data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(y).To(Equal(x))
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
+
+	Context("when encoding and then decoding with a typed codec", func() {
+		It("should return itself", func() {
+			codec, err := surge.NewTypedCodec[Envelope](surge.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(codec.Options()).To(Equal(surge.DefaultOptions()))
+
+			x := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			x.Padding = []struct{}{}
+			data, err := codec.Encode(x)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(HaveLen(codec.SizeHint(x)))
+			y, err := codec.Decode(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(y).To(Equal(x))
+
+			buf := make([]byte, codec.SizeHint(x))
+			tail, rem, err := codec.Marshal(x, buf, surge.MaxBytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tail).To(BeEmpty())
+			Expect(buf).To(Equal(data))
+			z := Envelope{}
+			tail, _, err = codec.Unmarshal(&z, buf, rem)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tail).To(BeEmpty())
+			Expect(z).To(Equal(x))
+		})
+	})
+
+	Context("when marshaling and unmarshaling with a typed codec", func() {
+		It("should agree with a codec", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			strict := surge.DefaultOptions()
+			strict.Strict = true
+			littleEndian := surge.DefaultOptions()
+			littleEndian.ByteOrder = binary.LittleEndian
+			shallow := surge.DefaultOptions()
+			shallow.MaxDepth = 4
+
+			for _, opts := range []surge.Options{surge.DefaultOptions(), strict, littleEndian, shallow} {
+				expectTypedCodecToAgree(mockEnvelope(r), opts)
+				expectTypedCodecToAgree(mockModel(), opts)
+				expectTypedCodecToAgree(nestedTree(6), opts)
+				expectTypedCodecToAgree(Block{Height: 1, Votes: []Vote{{Signature: []byte{1}}, {}}}, opts)
+				expectTypedCodecToAgree(Signer{Key: CompressedKey{1, 2, 3}}, opts)
+				expectTypedCodecToAgree(FixedStruct{Key: make(PubKey, 32), Ticker: "REN", Hash: make([]byte, 8)}, opts)
+				expectTypedCodecToAgree(MaxLenStruct{Name: "too long for the tag"}, opts)
+				expectTypedCodecToAgree(Release{Version: Version{Major: 1, Minor: 2}, Name: "release"}, opts)
+				expectTypedCodecToAgree(OptionsSpyContainer{}, opts)
+				expectTypedCodecToAgree([3][2]uint16{{1, 2}, {3, 4}, {5, 6}}, opts)
+				expectTypedCodecToAgree([]OrderedVotes{{{Round: 2, Signature: []byte{1}}, {Round: 1, Signature: []byte{1}}}}, opts)
+			}
+		})
+	})
+
+	Context("when constructing a typed codec", func() {
+		It("should accept supported types", func() {
+			_, err := surge.NewTypedCodec[Tree](surge.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = surge.NewTypedCodec[map[string][]Bar](surge.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should reject unsupported types", func() {
+			_, err := surge.NewTypedCodec[UnsupportedStruct](surge.DefaultOptions())
+			Expect(err).To(BeAssignableToTypeOf(surge.ErrUnsupportedMarshalType{}))
+			_, err = surge.NewTypedCodec[[]interface{}](surge.DefaultOptions())
+			Expect(err).To(BeAssignableToTypeOf(surge.ErrUnsupportedMarshalType{}))
+			_, err = surge.NewTypedCodec[map[int]string](surge.DefaultOptions())
+			Expect(err).To(BeAssignableToTypeOf(surge.ErrUnsupportedMarshalType{}))
+			_, err = surge.NewTypedCodec[UnsupportedPointerStruct](surge.DefaultOptions())
+			Expect(err).To(BeAssignableToTypeOf(surge.ErrUnsupportedUnmarshalType{}))
+		})
+
+		It("should report unsupported interface types", func() {
+			_, err := surge.NewTypedCodec[struct{ I interface{} }](surge.DefaultOptions())
+			Expect(err).To(BeAssignableToTypeOf(surge.ErrUnsupportedMarshalType{}))
+			Expect(err.Error()).To(Equal("marshal error: unsupported type interface {}"))
+		})
+
+		It("should reject custom implementations that cannot be unmarshaled", func() {
+			_, err := surge.NewTypedCodec[MarshalOnly](surge.DefaultOptions())
+			Expect(err).To(BeAssignableToTypeOf(surge.ErrUnsupportedUnmarshalType{}))
+			Expect(err.Error()).To(Equal("unmarshal error: unsupported type *surge_test.MarshalOnly"))
+
+			x := MarshalOnly(nil)
+			_, _, err = surge.Unmarshal(&x, []byte{}, surge.MaxBytes)
+			Expect(err).To(BeAssignableToTypeOf(surge.ErrUnsupportedUnmarshalType{}))
+		})
+
+		It("should reject invalid struct tags", func() {
+			_, err := surge.NewTypedCodec[[]InvalidKindStruct](surge.DefaultOptions())
+			Expect(err).To(BeAssignableToTypeOf(surge.ErrInvalidTag{}))
+		})
+
+		It("should agree with marshaling", func() {
+			for _, x := range []interface{}{UnsupportedStruct{}, []interface{}{nil}, map[int]string{0: ""}} {
+				_, err := surge.ToBinary(x)
+				Expect(reflect.TypeOf(err)).To(Equal(reflect.TypeOf(surge.ErrUnsupportedMarshalType{})))
+			}
+		})
+	})
+})
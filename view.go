@@ -0,0 +1,57 @@
+package surge
+
+import (
+	"reflect"
+)
+
+// A View is a lazy view over the binary representation of a value. Nested
+// values are unmarshaled on demand, and the values that come before them are
+// skipped in the same way as Locate (so only map keys, and values with custom
+// implementations, are allocated). Every step is checked against the end of
+// the byte slice, and the remaining memory quota, in the same way as
+// Unmarshal.
+type View struct {
+	codec *Codec
+	t     reflect.Type
+	buf   []byte
+}
+
+// NewView returns a lazy view over the binary representation of a value of the
+// given type. The byte slice is not copied, and must not be modified while the
+// view is in use.
+//
+//  view := surge.NewView(reflect.TypeOf(Block{}), data)
+//  height := uint64(0)
+//  if err := view.Get("Header.Height", &height); err != nil {
+//      panic(err)
+//  }
+//
+func NewView(t reflect.Type, buf []byte) View {
+	return defaultCodec.NewView(t, buf)
+}
+
+// NewView returns a lazy view over the binary representation of a value of the
+// given type. See the package-level NewView for more information.
+func (codec *Codec) NewView(t reflect.Type, buf []byte) View {
+	return View{codec: codec, t: t, buf: buf}
+}
+
+// Type of the value being viewed.
+func (view View) Type() reflect.Type {
+	return view.t
+}
+
+// Get unmarshals the value nested at the given path into a pointer. The path
+// uses the same syntax as Locate, and the pointer must point to a value of the
+// same type as the nested value. An empty path unmarshals the whole value.
+func (view View) Get(path string, v interface{}) error {
+	loc, tail, rem, err := view.codec.seek(view.t, view.buf, path)
+	if err != nil {
+		return err
+	}
+	if reflect.TypeOf(v) != reflect.PtrTo(loc.t) {
+		return NewErrTypeMismatch(reflect.PtrTo(loc.t), v)
+	}
+	_, _, err = view.codec.unmarshalTagged(reflect.ValueOf(v), loc.tag, tail, rem, loc.depth)
+	return err
+}
@@ -0,0 +1,111 @@
+package surge_test
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("View", func() {
+	Context("when getting a nested value", func() {
+		It("should return the nested value", func() {
+			envelope := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			envelope.Body = append(envelope.Body, mockTriangle(), mockTriangle())
+			envelope.Padding = []struct{}{}
+			data, err := surge.ToBinary(envelope)
+			Expect(err).ToNot(HaveOccurred())
+			view := surge.NewView(reflect.TypeOf(envelope), data)
+			Expect(view.Type()).To(Equal(reflect.TypeOf(envelope)))
+
+			height := uint64(0)
+			Expect(view.Get("Header.Height", &height)).To(Succeed())
+			Expect(height).To(Equal(envelope.Header.Height))
+
+			hash := []byte{}
+			Expect(view.Get("Header.Hash", &hash)).To(Succeed())
+			Expect(hash).To(Equal(envelope.Header.Hash))
+
+			tags := []uint16{}
+			Expect(view.Get("Tags[a]", &tags)).To(Succeed())
+			Expect(tags).To(Equal(envelope.Tags["a"]))
+
+			triangle := Triangle{}
+			Expect(view.Get("Body[1]", &triangle)).To(Succeed())
+			Expect(triangle).To(Equal(envelope.Body[1]))
+
+			memo := ""
+			Expect(view.Get("Memo", &memo)).To(Succeed())
+			Expect(memo).To(Equal(envelope.Memo))
+
+			whole := Envelope{}
+			Expect(view.Get("", &whole)).To(Succeed())
+			Expect(whole).To(Equal(envelope))
+		})
+
+		It("should not allocate the values that come before it", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			allocs := func(n int) float64 {
+				envelope := mockEnvelope(r)
+				envelope.Body = make([]Triangle, n)
+				data, err := surge.ToBinary(envelope)
+				Expect(err).ToNot(HaveOccurred())
+				view := surge.NewView(reflect.TypeOf(envelope), data)
+				memo := ""
+				return testing.AllocsPerRun(10, func() {
+					if err := view.Get("Memo", &memo); err != nil {
+						panic(err)
+					}
+				})
+			}
+			Expect(allocs(1000)).To(Equal(allocs(0)))
+		})
+	})
+
+	Context("when getting a nested value into the wrong type", func() {
+		It("should return an error", func() {
+			envelope := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			data, err := surge.ToBinary(envelope)
+			Expect(err).ToNot(HaveOccurred())
+			view := surge.NewView(reflect.TypeOf(envelope), data)
+
+			height := uint32(0)
+			Expect(view.Get("Header.Height", &height)).To(BeAssignableToTypeOf(surge.ErrTypeMismatch{}))
+			Expect(view.Get("Header.Height", uint64(0))).To(BeAssignableToTypeOf(surge.ErrTypeMismatch{}))
+		})
+	})
+
+	Context("when getting a nested value from a buffer that is too small", func() {
+		It("should return an error", func() {
+			envelope := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			data, err := surge.ToBinary(envelope)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, end, err := surge.Locate(reflect.TypeOf(envelope), data, "Body")
+			Expect(err).ToNot(HaveOccurred())
+			for n := 0; n < end; n++ {
+				body := []Triangle{}
+				view := surge.NewView(reflect.TypeOf(envelope), data[:n])
+				Expect(view.Get("Body", &body)).To(Equal(surge.ErrUnexpectedEndOfBuffer))
+			}
+		})
+	})
+
+	Context("when getting a nested value that exceeds the memory quota", func() {
+		It("should return an error", func() {
+			envelope := mockEnvelope(rand.New(rand.NewSource(GinkgoRandomSeed())))
+			envelope.Body = make([]Triangle, 10)
+			data, err := surge.ToBinary(envelope)
+			Expect(err).ToNot(HaveOccurred())
+
+			codec := surge.NewCodec(surge.Options{MaxBytes: len(data) / 2})
+			view := codec.NewView(reflect.TypeOf(envelope), data)
+			memo := ""
+			Expect(view.Get("Memo", &memo)).To(Equal(surge.ErrUnexpectedEndOfBuffer))
+		})
+	})
+})